@@ -22,20 +22,61 @@ type handler interface {
 	PrepareNamedContext(ctx context.Context, query string) (*sqlx.NamedStmt, error)
 }
 
+// preparer is implemented by handlers that prepare positional statements,
+// which the statement cache needs for them.
+type preparer interface {
+	PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error)
+}
+
 type SQL struct {
 	Query string
 	Args  []interface{}
+
+	// sensitive is set when some of Args bind sensitive columns, which mask
+	// marks. A nil mask redacts all of them.
+	sensitive bool
+	mask      []bool
+	op        Op
 }
 
 type Builder struct {
-	h  handler
-	ts *time.Time
+	h     handler
+	ts    *time.Time
+	stmts *stmtCache
+	log   Logger
+
+	interceptors []Interceptor
+	tracer       Tracer
+	slow         *slowLog
+
+	tautologyGuard bool
 }
 
-func NewBuilder(h handler) *Builder {
-	return &Builder{
+// Option configures a Builder created by NewBuilder.
+type Option func(*Builder)
+
+// WithStmtCache keeps up to size prepared statements keyed by the generated
+// SQL and the database they are prepared on. When the builder runs on a
+// transaction of its handler, statements prepared on the handler are
+// rebound to it with tx.Stmtx. Statements run on a transaction torm did not
+// begin, or positional ones on a handler without PreparexContext, are not
+// cached. Statements evicted from the cache are closed.
+func WithStmtCache(size int) Option {
+	return func(b *Builder) {
+		if size > 0 {
+			b.stmts = newStmtCache(size)
+		}
+	}
+}
+
+func NewBuilder(h handler, opts ...Option) *Builder {
+	b := &Builder{
 		h: h,
 	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
 }
 
 func (t Builder) Querier() querier {
@@ -43,21 +84,134 @@ func (t Builder) Querier() querier {
 }
 
 func (t Builder) Select(f ...string) *selectBuilder {
-	return newSelect(t.h, f...)
+	return newSelect(&t, f...)
 }
 
 func (t Builder) Insert(f ...string) *insertBuilder {
-	return newInsert(t.h, t.ts, f...)
+	return newInsert(&t, f...)
 }
 
 func (t Builder) Update(f ...string) *updateBuilder {
-	return newUpdate(t.h, t.ts, f...)
+	return newUpdate(&t, f...)
 }
 
 func (t Builder) Delete() *deleteBuilder {
-	return newDelete(t.h)
+	return newDelete(&t)
 }
 
 func (t *Builder) SetTime(ts *time.Time) {
 	t.ts = ts
 }
+
+// Close closes the statements held by the statement cache, if any.
+func (t *Builder) Close() error {
+	if t.stmts == nil {
+		return nil
+	}
+	return t.stmts.Close()
+}
+
+// namedExec runs an insert or update whose only argument is the schema.
+func (t *Builder) namedExec(ctx context.Context, h handler, s *SQL) (sql.Result, error) {
+	res, err := t.invoke(ctx, h, s, func(ctx context.Context, op Op, s *SQL) (Result, error) {
+		prep, ok := t.stmtHandler(ctx, h, true)
+		if !ok {
+			return execResult(h.NamedExecContext(ctx, s.Query, s.Args[0]))
+		}
+		var r sql.Result
+		err := t.withStmt(ctx, h, prep, true, s.Query, func(stmt *sqlx.NamedStmt) (err error) {
+			r, err = stmt.ExecContext(ctx, s.Args[0])
+			return
+		})
+		return execResult(r, err)
+	})
+	return res.Exec, err
+}
+
+// exec runs a statement with positional arguments.
+func (t *Builder) exec(ctx context.Context, h handler, s *SQL) (sql.Result, error) {
+	res, err := t.invoke(ctx, h, s, func(ctx context.Context, op Op, s *SQL) (Result, error) {
+		prep, ok := t.stmtHandler(ctx, h, false)
+		if !ok {
+			return execResult(h.ExecContext(ctx, s.Query, s.Args...))
+		}
+		var r sql.Result
+		err := t.withStmt(ctx, h, prep, false, s.Query, func(stmt *sqlx.NamedStmt) (err error) {
+			r, err = stmt.Stmt.ExecContext(ctx, s.Args...)
+			return
+		})
+		return execResult(r, err)
+	})
+	return res.Exec, err
+}
+
+// query scans the rows of s into dest, a slice when many is true.
+func (t *Builder) query(ctx context.Context, h handler, dest interface{}, s *SQL, many bool) error {
+	_, err := t.invoke(ctx, h, s, func(ctx context.Context, op Op, s *SQL) (Result, error) {
+		var err error
+		if o, ok := h.(observer); ok {
+			start := time.Now()
+			defer func() {
+				o.observe(time.Since(start), err)
+			}()
+		}
+		prep, cached := t.stmtHandler(ctx, h, false)
+		switch {
+		case !cached && many:
+			err = h.SelectContext(ctx, dest, s.Query, s.Args...)
+		case !cached:
+			err = h.GetContext(ctx, dest, s.Query, s.Args...)
+		default:
+			err = t.withStmt(ctx, h, prep, false, s.Query, func(stmt *sqlx.NamedStmt) error {
+				if many {
+					return stmt.Stmt.SelectContext(ctx, dest, s.Args...)
+				}
+				return stmt.Stmt.GetContext(ctx, dest, s.Args...)
+			})
+		}
+		return queryResult(dest, many, err)
+	})
+	return err
+}
+
+// stmtHandler returns the handler the statements run on h are prepared on,
+// or false when they are not cached. Statements for a transaction torm began
+// are prepared on the database it was begun on; those for a transaction it
+// did not begin would die with it, and are not cached.
+func (t *Builder) stmtHandler(ctx context.Context, h handler, named bool) (handler, bool) {
+	if t.stmts == nil {
+		return nil, false
+	}
+	prep := h
+	if tx, ok := h.(*sqlx.Tx); ok {
+		scope := scopeOfTx(tx)
+		if scope == nil {
+			return nil, false
+		}
+		prep = scope.db
+		if r, ok := prep.(router); ok {
+			prep = r.route(ctx, true)
+		}
+	}
+	if _, ok := prep.(preparer); !named && !ok {
+		return nil, false
+	}
+	return prep, true
+}
+
+// withStmt calls fn with the statement for query cached on prep, rebound to
+// h when h is a transaction.
+func (t *Builder) withStmt(ctx context.Context, h, prep handler, named bool, query string, fn func(*sqlx.NamedStmt) error) error {
+	e, err := t.stmts.acquire(ctx, prep, named, query)
+	if err != nil {
+		return err
+	}
+	defer t.stmts.release(e)
+
+	stmt := e.stmt
+	if prep != h {
+		stmt = h.(*sqlx.Tx).NamedStmtContext(ctx, stmt)
+		defer stmt.Close()
+	}
+	return fn(stmt)
+}
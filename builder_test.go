@@ -2,7 +2,9 @@ package torm
 
 import (
 	"context"
+	"regexp"
 	"testing"
+	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
@@ -32,3 +34,144 @@ func TestBuilder(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestBuilderStmtCache(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		prep := mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ?"))
+		prep.ExpectExec().WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		prep.ExpectExec().WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		builder := NewBuilder(db, WithStmtCache(8))
+		defer builder.Close()
+		for _, foo := range []int{1, 2} {
+			if _, err := builder.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: foo}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if builder.stmts.Len() != 1 {
+			t.Errorf("cached statements is %d, 1 was expected", builder.stmts.Len())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuilderStmtCacheEviction(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectPrepare(regexp.QuoteMeta("SELECT * FROM `test`")).
+			WillBeClosed().
+			ExpectQuery().
+			WillReturnRows(sqlmock.NewRows([]string{"foo"}).AddRow(1))
+		mock.ExpectPrepare(regexp.QuoteMeta("SELECT `foo` FROM `test`")).
+			ExpectQuery().
+			WillReturnRows(sqlmock.NewRows([]string{"foo"}).AddRow(1))
+
+		builder := NewBuilder(db, WithStmtCache(1))
+		defer builder.Close()
+		ts := []test.TestSchema{}
+		if err := builder.Select("*").Query(ctx, &ts); err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.Select("foo").Query(ctx, &ts); err != nil {
+			t.Fatal(err)
+		}
+		if builder.stmts.Len() != 1 {
+			t.Errorf("cached statements is %d, 1 was expected", builder.stmts.Len())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuilderStmtCacheTx(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		tm := time.Now()
+		prep := mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO `test` (`foo`,`created_at`,`updated_at`) VALUES (?,?,?)"))
+		prep.ExpectExec().WithArgs(1, tm, tm).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectBegin()
+		prep.ExpectExec().WithArgs(2, tm, tm).WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		builder := NewBuilder(db, WithStmtCache(8))
+		defer builder.Close()
+		builder.SetTime(&tm)
+		if _, err := builder.Insert("foo").Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+			_, err := b.Insert("foo").Exec(ctx, &test.TestSchema{Foo: 2})
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuilderStmtCacheUserTx(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder := NewBuilder(tx, WithStmtCache(8))
+		defer builder.Close()
+		if _, err := builder.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if builder.stmts.Len() != 0 {
+			t.Errorf("cached statements is %d, none was expected", builder.stmts.Len())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// namedOnly is a handler that can't prepare positional statements.
+type namedOnly struct {
+	handler
+}
+
+func TestBuilderStmtCacheWithoutPreparer(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		builder := NewBuilder(namedOnly{db}, WithStmtCache(8))
+		defer builder.Close()
+		if _, err := builder.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if builder.stmts.Len() != 0 {
+			t.Errorf("cached statements is %d, none was expected", builder.stmts.Len())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,92 @@
+package torm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrNoTransaction = errors.New("torm: not in a transaction begun by torm")
+
+// OnCommit registers fn to run once the transaction carried by ctx has
+// committed. Callbacks run in registration order after Commit returns.
+// Callbacks registered inside a savepoint are handed to the enclosing
+// transaction when the savepoint is released and dropped when it is rolled
+// back.
+func OnCommit(ctx context.Context, fn func()) error {
+	return register(txFromContext(ctx), true, fn)
+}
+
+// OnRollback registers fn to run once the transaction carried by ctx, or
+// the savepoint it was registered in, has been rolled back. With WithRetry,
+// callbacks of attempts that are retried are dropped; only those of the
+// last attempt run.
+func OnRollback(ctx context.Context, fn func()) error {
+	return register(txFromContext(ctx), false, fn)
+}
+
+// OnCommit is like the package level OnCommit for the transaction the
+// builder is bound to.
+func (t *Builder) OnCommit(fn func()) error {
+	return register(t.txScope(), true, fn)
+}
+
+// OnRollback is like the package level OnRollback for the transaction the
+// builder is bound to.
+func (t *Builder) OnRollback(fn func()) error {
+	return register(t.txScope(), false, fn)
+}
+
+func (t *Builder) txScope() *txScope {
+	if tx, ok := t.h.(*sqlx.Tx); ok {
+		return scopeOfTx(tx)
+	}
+	return nil
+}
+
+func register(scope *txScope, commit bool, fn func()) error {
+	if scope == nil || scope.detached {
+		return ErrNoTransaction
+	}
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	if commit {
+		scope.onCommit = append(scope.onCommit, fn)
+	} else {
+		scope.onRollback = append(scope.onRollback, fn)
+	}
+	return nil
+}
+
+// release hands the callbacks of a released savepoint to its parent, whose
+// outcome decides whether they run.
+func (s *txScope) release() {
+	if s.parent == nil {
+		return
+	}
+	s.mu.Lock()
+	onCommit, onRollback := s.onCommit, s.onRollback
+	s.onCommit, s.onRollback = nil, nil
+	s.mu.Unlock()
+
+	s.parent.mu.Lock()
+	defer s.parent.mu.Unlock()
+	s.parent.onCommit = append(s.parent.onCommit, onCommit...)
+	s.parent.onRollback = append(s.parent.onRollback, onRollback...)
+}
+
+// finish runs the callbacks for the final outcome of the scope.
+func (s *txScope) finish(committed bool) {
+	s.mu.Lock()
+	fns := s.onRollback
+	if committed {
+		fns = s.onCommit
+	}
+	s.onCommit, s.onRollback = nil, nil
+	s.mu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
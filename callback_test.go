@@ -0,0 +1,179 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+func TestOnCommit(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		events := []string{}
+		if err := NewBuilder(db).Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+			if err := OnCommit(ctx, func() { events = append(events, "commit 1") }); err != nil {
+				return err
+			}
+			if err := b.OnCommit(func() { events = append(events, "commit 2") }); err != nil {
+				return err
+			}
+			if err := OnRollback(ctx, func() { events = append(events, "rollback") }); err != nil {
+				return err
+			}
+			if len(events) != 0 {
+				t.Error("callbacks ran before commit")
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"commit 1", "commit 2"}; !reflect.DeepEqual(events, want) {
+			t.Errorf("events are %v, %v was expected", events, want)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOnRollback(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		events := []string{}
+		if err := Transaction(ctx, nil, db, func(tx *sqlx.Tx) error {
+			b := NewBuilder(tx)
+			if err := b.OnCommit(func() { events = append(events, "commit") }); err != nil {
+				return err
+			}
+			if err := b.OnRollback(func() { events = append(events, "rollback") }); err != nil {
+				return err
+			}
+			return errors.New("proc error")
+		}); err == nil {
+			t.Fatal("error was expected")
+		}
+		if want := []string{"rollback"}; !reflect.DeepEqual(events, want) {
+			t.Errorf("events are %v, %v was expected", events, want)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCallbacksInSavepoint(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("RELEASE SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		events := []string{}
+		builder := NewBuilder(db)
+		if err := builder.Transaction(ctx, nil, func(ctx context.Context, _ *Builder) error {
+			if err := builder.Transaction(ctx, nil, func(ctx context.Context, _ *Builder) error {
+				_ = OnCommit(ctx, func() { events = append(events, "released commit") })
+				_ = OnRollback(ctx, func() { events = append(events, "released rollback") })
+				return nil
+			}); err != nil {
+				return err
+			}
+			_ = builder.Transaction(ctx, nil, func(ctx context.Context, _ *Builder) error {
+				_ = OnCommit(ctx, func() { events = append(events, "failed commit") })
+				_ = OnRollback(ctx, func() { events = append(events, "failed rollback") })
+				return errors.New("savepoint error")
+			})
+			return OnCommit(ctx, func() { events = append(events, "outer commit") })
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"failed rollback", "released commit", "outer commit"}; !reflect.DeepEqual(events, want) {
+			t.Errorf("events are %v, %v was expected", events, want)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOnCommitWithoutTransaction(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		if err := OnCommit(ctx, func() {}); !errors.Is(err, ErrNoTransaction) {
+			t.Errorf("ErrNoTransaction was expected: %v", err)
+		}
+		if err := NewBuilder(db).OnRollback(func() {}); !errors.Is(err, ErrNoTransaction) {
+			t.Errorf("ErrNoTransaction was expected: %v", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCallbacksAfterRetry(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		deadlock := errors.New("Error 1213 (40001): Deadlock found")
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `test`").WithArgs(1).WillReturnError(deadlock)
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `test`").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `test`").WithArgs(1).WillReturnError(deadlock)
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `test`").WithArgs(1).WillReturnError(deadlock)
+		mock.ExpectRollback()
+
+		events := []string{}
+		attempt := 0
+		run := func() error {
+			return NewBuilder(db).Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+				attempt++
+				n := attempt
+				_ = b.OnCommit(func() { events = append(events, "commit "+strconv.Itoa(n)) })
+				_ = b.OnRollback(func() { events = append(events, "rollback "+strconv.Itoa(n)) })
+				_, err := b.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1})
+				return err
+			}, WithRetry(RetryPolicy{MaxAttempts: 2}))
+		}
+
+		if err := run(); err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"commit 2"}; !reflect.DeepEqual(events, want) {
+			t.Errorf("events are %v, %v was expected", events, want)
+		}
+
+		events = events[:0]
+		if err := run(); err == nil {
+			t.Fatal("error was expected")
+		}
+		if want := []string{"rollback 4"}; !reflect.DeepEqual(events, want) {
+			t.Errorf("events are %v, %v was expected", events, want)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,186 @@
+package torm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// router is implemented by handlers that spread statements over several
+// databases. Builders ask it for the database a statement should run on.
+type router interface {
+	route(ctx context.Context, write bool) handler
+}
+
+// observer is implemented by handlers that want to know how long the
+// statements builders ran on them took, and whether they failed.
+type observer interface {
+	observe(d time.Duration, err error)
+}
+
+type primaryKey struct{}
+
+// UsePrimary returns a context under which a Cluster sends reads to the
+// primary as well, for reads that must see the caller's own writes.
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func usesPrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
+
+// Balance picks the replica a read runs on.
+type Balance int
+
+const (
+	RoundRobin Balance = iota
+	// LeastLatency sends reads to the replica with the lowest average
+	// latency. One read in probeEvery goes round robin instead, so that the
+	// averages of the other replicas keep up to date, and failed reads
+	// count as taking at least errorPenalty.
+	LeastLatency
+)
+
+const (
+	probeEvery   = 16
+	errorPenalty = time.Second
+)
+
+// ClusterOption configures a Cluster.
+type ClusterOption func(*Cluster)
+
+func WithBalance(b Balance) ClusterOption {
+	return func(c *Cluster) {
+		c.balance = b
+	}
+}
+
+// Cluster is a handler over one primary and any number of replicas. Reads
+// made by select builders go to a replica; writes, transactions and reads
+// under UsePrimary go to the primary. With no replicas everything goes to
+// the primary.
+type Cluster struct {
+	primary  *sqlx.DB
+	replicas []*replica
+	balance  Balance
+	next     uint64
+}
+
+// replica keeps a moving average of the read latency of a database.
+type replica struct {
+	*sqlx.DB
+	latency int64
+}
+
+func (r *replica) observe(d time.Duration, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) && d < errorPenalty {
+		// a replica that fails fast must not look like the fastest.
+		d = errorPenalty
+	}
+	for {
+		old := atomic.LoadInt64(&r.latency)
+		avg := int64(d)
+		if old > 0 {
+			avg = old + (int64(d)-old)/8
+		}
+		if atomic.CompareAndSwapInt64(&r.latency, old, avg) {
+			return
+		}
+	}
+}
+
+func NewCluster(primary *sqlx.DB, replicas []*sqlx.DB, opts ...ClusterOption) *Cluster {
+	c := &Cluster{
+		primary: primary,
+	}
+	for _, db := range replicas {
+		c.replicas = append(c.replicas, &replica{DB: db})
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Cluster) Primary() *sqlx.DB {
+	return c.primary
+}
+
+func (c *Cluster) route(ctx context.Context, write bool) handler {
+	if write || usesPrimary(ctx) || len(c.replicas) == 0 {
+		return c.primary
+	}
+	return c.replica()
+}
+
+func (c *Cluster) replica() *replica {
+	n := atomic.AddUint64(&c.next, 1)
+	if c.balance == LeastLatency && n%probeEvery != 0 {
+		best := c.replicas[0]
+		for _, r := range c.replicas[1:] {
+			if atomic.LoadInt64(&r.latency) < atomic.LoadInt64(&best.latency) {
+				best = r
+			}
+		}
+		return best
+	}
+	return c.replicas[(n-1)%uint64(len(c.replicas))]
+}
+
+func (c *Cluster) read(ctx context.Context, fn func(h handler) error) error {
+	h := c.route(ctx, false)
+	o, ok := h.(observer)
+	if !ok {
+		return fn(h)
+	}
+	start := time.Now()
+	err := fn(h)
+	o.observe(time.Since(start), err)
+	return err
+}
+
+func (c *Cluster) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.read(ctx, func(h handler) error {
+		return h.GetContext(ctx, dest, query, args...)
+	})
+}
+
+func (c *Cluster) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.read(ctx, func(h handler) error {
+		return h.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+func (c *Cluster) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return c.primary.NamedExecContext(ctx, query, arg)
+}
+
+func (c *Cluster) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.primary.ExecContext(ctx, query, args...)
+}
+
+func (c *Cluster) Rebind(query string) string {
+	return c.primary.Rebind(query)
+}
+
+func (c *Cluster) DriverName() string {
+	return c.primary.DriverName()
+}
+
+func (c *Cluster) PrepareNamedContext(ctx context.Context, query string) (*sqlx.NamedStmt, error) {
+	return c.primary.PrepareNamedContext(ctx, query)
+}
+
+func (c *Cluster) PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error) {
+	return c.primary.PreparexContext(ctx, query)
+}
+
+func (c *Cluster) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	return c.primary.BeginTxx(ctx, opts)
+}
@@ -0,0 +1,154 @@
+package torm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+func withCluster(t *testing.T, replicas int, proc func(ctx context.Context, c *Cluster, primary sqlmock.Sqlmock, mocks []sqlmock.Sqlmock)) {
+	err := test.WithSqlxMock(func(ctx context.Context, primary *sqlx.DB, pmock sqlmock.Sqlmock) {
+		dbs := []*sqlx.DB{}
+		mocks := []sqlmock.Sqlmock{}
+		for i := 0; i < replicas; i++ {
+			mdb, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mdb.Close()
+			dbs = append(dbs, sqlx.NewDb(mdb, "mysql"))
+			mocks = append(mocks, mock)
+		}
+		proc(ctx, NewCluster(primary, dbs), pmock, mocks)
+
+		for _, mock := range append(mocks, pmock) {
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClusterReadWrite(t *testing.T) {
+	withCluster(t, 1, func(ctx context.Context, c *Cluster, primary sqlmock.Sqlmock, replicas []sqlmock.Sqlmock) {
+		replicas[0].ExpectQuery(regexp.QuoteMeta("SELECT * FROM `test`")).
+			WillReturnRows(sqlmock.NewRows([]string{"foo"}).AddRow(1))
+		primary.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		primary.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `test`")).
+			WillReturnRows(sqlmock.NewRows([]string{"foo"}).AddRow(1))
+
+		builder := NewBuilder(c)
+		ts := test.TestSchema{}
+		if err := builder.Select("*").Query(ctx, &ts); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := builder.Delete().Where("foo = :foo").Exec(ctx, &ts); err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.Select("*").Query(UsePrimary(ctx), &ts); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestClusterTransaction(t *testing.T) {
+	withCluster(t, 1, func(ctx context.Context, c *Cluster, primary sqlmock.Sqlmock, replicas []sqlmock.Sqlmock) {
+		primary.ExpectBegin()
+		primary.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `test`")).
+			WillReturnRows(sqlmock.NewRows([]string{"foo"}).AddRow(1))
+		primary.ExpectCommit()
+
+		builder := NewBuilder(c)
+		if err := builder.Transaction(ctx, nil, func(ctx context.Context, _ *Builder) error {
+			ts := test.TestSchema{}
+			return builder.Select("*").Query(ctx, &ts)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestClusterRoundRobin(t *testing.T) {
+	withCluster(t, 2, func(ctx context.Context, c *Cluster, primary sqlmock.Sqlmock, replicas []sqlmock.Sqlmock) {
+		for i := 0; i < 2; i++ {
+			for _, mock := range replicas {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `test`")).
+					WillReturnRows(sqlmock.NewRows([]string{"foo"}).AddRow(1))
+			}
+		}
+
+		builder := NewBuilder(c)
+		for i := 0; i < 4; i++ {
+			ts := []test.TestSchema{}
+			if err := builder.Select("*").Query(ctx, &ts); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestClusterLeastLatency(t *testing.T) {
+	c := NewCluster(nil, []*sqlx.DB{{}, {}}, WithBalance(LeastLatency))
+	c.replicas[0].observe(10*time.Millisecond, nil)
+	c.replicas[1].observe(time.Millisecond, nil)
+	if h := c.route(context.Background(), false); h != c.replicas[1] {
+		t.Error("the fastest replica was expected")
+	}
+	for i := 0; i < 32; i++ {
+		c.replicas[1].observe(50*time.Millisecond, nil)
+	}
+	if h := c.route(context.Background(), false); h != c.replicas[0] {
+		t.Error("the fastest replica was expected after the latency changed")
+	}
+	if h := c.route(context.Background(), true); h != handler(c.primary) {
+		t.Error("writes must go to the primary")
+	}
+}
+
+func TestClusterLeastLatencyErrors(t *testing.T) {
+	c := NewCluster(nil, []*sqlx.DB{{}, {}}, WithBalance(LeastLatency))
+	c.replicas[0].observe(10*time.Millisecond, nil)
+	// the broken replica refuses connections right away.
+	c.replicas[1].observe(time.Microsecond, errors.New("connection refused"))
+	if h := c.route(context.Background(), false); h != c.replicas[0] {
+		t.Error("a failing replica must not be picked as the fastest")
+	}
+	c.replicas[1].observe(time.Millisecond, sql.ErrNoRows)
+	if got := time.Duration(c.replicas[1].latency); got >= errorPenalty {
+		t.Errorf("ErrNoRows was counted as a failure: %s", got)
+	}
+}
+
+func TestClusterLeastLatencyProbes(t *testing.T) {
+	c := NewCluster(nil, []*sqlx.DB{{}, {}}, WithBalance(LeastLatency))
+	c.replicas[0].observe(10*time.Millisecond, nil)
+	// replica 1 was slow once, then recovered.
+	c.replicas[1].observe(time.Second, nil)
+	picked := 0
+	for i := 0; i < 4*probeEvery; i++ {
+		if c.route(context.Background(), false) == c.replicas[1] {
+			picked++
+		}
+	}
+	if picked == 0 {
+		t.Fatal("a slow replica was never probed again")
+	}
+	for i := 0; i < 64; i++ {
+		c.replicas[1].observe(time.Millisecond, nil)
+	}
+	if h := c.route(context.Background(), false); h != c.replicas[1] {
+		t.Error("the recovered replica was expected")
+	}
+}
@@ -0,0 +1,114 @@
+package torm
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// CommentFunc returns key/value pairs to attach to the statements run with
+// ctx, such as a traceparent taken from the span ctx carries.
+type CommentFunc func(ctx context.Context) map[string]string
+
+type commentKey struct{}
+
+// WithComment returns a context whose statements are commented with
+// key=value by builders created with WithSQLCommenter.
+func WithComment(ctx context.Context, key, value string) context.Context {
+	prev, _ := ctx.Value(commentKey{}).(map[string]string)
+	tags := make(map[string]string, len(prev)+1)
+	for k, v := range prev {
+		tags[k] = v
+	}
+	tags[key] = value
+	return context.WithValue(ctx, commentKey{}, tags)
+}
+
+// WithSQLCommenter appends a sqlcommenter comment to every statement the
+// builder runs, built from the WithComment values of the context and from
+// sources, later ones taking precedence. Statements that already contain a
+// comment are left alone. Values that change with every request, like a
+// traceparent, defeat WithStmtCache since each statement text is unique.
+func WithSQLCommenter(sources ...CommentFunc) Option {
+	return WithInterceptors(func(ctx context.Context, op Op, sql *SQL, next Invoker) (Result, error) {
+		tags, _ := ctx.Value(commentKey{}).(map[string]string)
+		for _, source := range sources {
+			extra := source(ctx)
+			if len(extra) == 0 {
+				continue
+			}
+			merged := make(map[string]string, len(tags)+len(extra))
+			for k, v := range tags {
+				merged[k] = v
+			}
+			for k, v := range extra {
+				merged[k] = v
+			}
+			tags = merged
+		}
+		if len(tags) == 0 || hasComment(sql.Query) {
+			return next(ctx, op, sql)
+		}
+		s := *sql
+		s.Query += " " + sqlComment(tags)
+		return next(ctx, op, &s)
+	})
+}
+
+// hasComment reports whether query contains a -- or /* comment outside of
+// quoted strings and identifiers.
+func hasComment(query string) bool {
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case strings.HasPrefix(query[i:], "--") || strings.HasPrefix(query[i:], "/*"):
+			return true
+		}
+	}
+	return false
+}
+
+// sqlComment serializes tags as specified by sqlcommenter: keys and values
+// are URL encoded and have their quotes escaped, values are quoted and the
+// pairs are sorted by key.
+func sqlComment(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, commentEscape(k)+"='"+commentEscape(tags[k])+"'")
+	}
+	return "/*" + strings.Join(pairs, ",") + "*/"
+}
+
+// commentEscape encodes s like JavaScript's encodeURIComponent, which the
+// sqlcommenter reference implementations use, then escapes single quotes.
+func commentEscape(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			strings.IndexByte("-_.!~*()", c) >= 0:
+			b.WriteByte(c)
+		case c == '\'':
+			b.WriteString(`\'`)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
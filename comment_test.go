@@ -0,0 +1,78 @@
+package torm
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+func TestSQLCommenter(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ? /*app='billing',route='%2Fusers%2F%3Aid',traceparent='00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01'*/")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ? /* keep */")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		traceparent := func(ctx context.Context) map[string]string {
+			return map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+		}
+		builder := NewBuilder(db, WithSQLCommenter(traceparent))
+		cctx := WithComment(WithComment(ctx, "route", "/users/:id"), "app", "billing")
+		if _, err := builder.Delete().Where("foo = :foo").Exec(cctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := builder.Delete().Where("foo = :foo /* keep */").Exec(cctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewBuilder(db).Delete().Where("foo = :foo").Exec(cctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLCommentEscaping(t *testing.T) {
+	got := sqlComment(map[string]string{
+		"route":          "/param*d",
+		"name'":          "DROP TABLE FOO",
+		"controller":     "index",
+		"framework":      "spring",
+		"meta":           "it's",
+		"with space key": "a,b=c",
+		"meta-data":      "x",
+	})
+	want := `/*controller='index',framework='spring',meta='it\'s',meta-data='x',name\'='DROP%20TABLE%20FOO',route='%2Fparam*d',with%20space%20key='a%2Cb%3Dc'*/`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestHasComment(t *testing.T) {
+	for query, want := range map[string]bool{
+		"SELECT 1":                         false,
+		"SELECT 1 -- note":                 true,
+		"SELECT 1 /* note */":              true,
+		"SELECT '--' FROM t":               false,
+		"SELECT * FROM t WHERE a = '/* x'": false,
+		"SELECT `a--b` FROM t":             false,
+		`SELECT "/*" FROM t -- note`:       true,
+		"SELECT 1 - -1":                    false,
+	} {
+		if got := hasComment(query); got != want {
+			t.Errorf("hasComment(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
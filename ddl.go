@@ -0,0 +1,335 @@
+package torm
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// columnDef holds the DDL options of a column, set with the type:, size:,
+// default:, notNull, unique, index:name and primaryKey torm tag options.
+type columnDef struct {
+	goType     reflect.Type
+	typ        string
+	size       int
+	def        string
+	hasDefault bool
+	notNull    bool
+	unique     bool
+	primaryKey bool
+	indexes    []string
+	// err is the error of an option that can't be parsed, reported when
+	// the DDL is generated rather than by Register.
+	err error
+}
+
+// CreateTables returns the statements that create the registered tables,
+// or all of them when none are given: a CREATE TABLE per table followed by
+// the CREATE INDEX of its indexes. Tables come after the tables they
+// reference.
+func CreateTables(d Dialect, tables ...string) ([]string, error) {
+	if len(tables) == 0 {
+		tables = Tables()
+	}
+	order, err := ReferenceOrder(tables)
+	if err != nil {
+		return nil, err
+	}
+	var stmts []string
+	for _, table := range order {
+		s, err := metas[table].createTable(d)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, s...)
+	}
+	return stmts, nil
+}
+
+// primaryKey returns the columns tagged primaryKey, or the auto increment
+// ones when there are none.
+func (m *tableMeta) primaryKey() []string {
+	var pk []string
+	for i, def := range m.columns {
+		if def.primaryKey {
+			pk = append(pk, m.Fields[i])
+		}
+	}
+	if len(pk) == 0 {
+		pk = cloneFields(m.AutoIncrementColumns)
+	}
+	return pk
+}
+
+func (m *tableMeta) createTable(d Dialect) ([]string, error) {
+	pk := m.primaryKey()
+	inlinePK := false
+	lines := make([]string, 0, len(m.Fields)+2)
+	for i, col := range m.Fields {
+		def := m.columns[i]
+		if def.err != nil {
+			return nil, fmt.Errorf("torm: %s.%s: %w", m.TableName, col, def.err)
+		}
+		typ, err := d.columnType(def)
+		if err != nil {
+			return nil, fmt.Errorf("torm: %s.%s: %w", m.TableName, col, err)
+		}
+
+		line := d.Quote(col) + " " + typ
+		if m.IsAutoIncrement(col) {
+			switch d {
+			case SQLite:
+				// SQLite only autoincrements an INTEGER PRIMARY KEY.
+				if len(pk) != 1 || pk[0] != col {
+					return nil, fmt.Errorf("torm: %s.%s: sqlite3 only autoincrements a single column primary key", m.TableName, col)
+				}
+				line = d.Quote(col) + " INTEGER PRIMARY KEY AUTOINCREMENT"
+				inlinePK = true
+			case Postgres:
+				line += " GENERATED BY DEFAULT AS IDENTITY"
+			case SQLServer:
+				line += " IDENTITY(1,1)"
+			default:
+				line += " AUTO_INCREMENT"
+			}
+		}
+		if def.notNull || (containsField(pk, col) && !inlinePK) {
+			line += " NOT NULL"
+		}
+		if def.hasDefault {
+			line += " DEFAULT " + d.defaultValue(def.def)
+		}
+		if def.unique {
+			line += " UNIQUE"
+		}
+		lines = append(lines, line)
+	}
+
+	if len(pk) > 0 && !inlinePK {
+		lines = append(lines, "PRIMARY KEY ("+d.quoteColumns(pk)+")")
+	}
+	for _, col := range m.Fields {
+		ref, ok := m.references[col]
+		if !ok {
+			continue
+		}
+		table, refCol, _ := strings.Cut(ref, ".")
+		if refCol == "" {
+			refMeta, ok := metas[table]
+			if !ok || len(refMeta.primaryKey()) != 1 {
+				return nil, fmt.Errorf("torm: %s.%s: give the referenced column as references:%s.column", m.TableName, col, table)
+			}
+			refCol = refMeta.primaryKey()[0]
+		}
+		lines = append(lines, "FOREIGN KEY ("+d.Quote(col)+") REFERENCES "+d.QuoteTable(table)+" ("+d.Quote(refCol)+")")
+	}
+
+	stmts := []string{"CREATE TABLE " + d.QuoteTable(m.TableName) + " (\n  " + strings.Join(lines, ",\n  ") + "\n)"}
+
+	var names []string
+	indexes := map[string][]string{}
+	for i, def := range m.columns {
+		for _, name := range def.indexes {
+			if name == "" {
+				name = "idx_" + strings.ReplaceAll(m.TableName, ".", "_") + "_" + m.Fields[i]
+			}
+			if _, ok := indexes[name]; !ok {
+				names = append(names, name)
+			}
+			indexes[name] = append(indexes[name], m.Fields[i])
+		}
+	}
+	for _, name := range names {
+		stmts = append(stmts, "CREATE INDEX "+d.Quote(name)+" ON "+d.QuoteTable(m.TableName)+" ("+d.quoteColumns(indexes[name])+")")
+	}
+	return stmts, nil
+}
+
+// defaultKeywords are the default: values written as they are.
+var defaultKeywords = map[string]bool{
+	"NULL":              true,
+	"CURRENT_TIMESTAMP": true,
+	"CURRENT_DATE":      true,
+	"CURRENT_TIME":      true,
+	"LOCALTIMESTAMP":    true,
+}
+
+// defaultValue renders the default: option of a column. Numbers, the
+// keywords above, quoted literals and parenthesized expressions are
+// written as they are; other values are quoted as strings. The boolean
+// keywords are written as 1 and 0 for dialects without them.
+func (d Dialect) defaultValue(v string) string {
+	switch {
+	case strings.EqualFold(v, "true") || strings.EqualFold(v, "false"):
+		if d != SQLite && d != SQLServer {
+			return v
+		}
+		if strings.EqualFold(v, "true") {
+			return "1"
+		}
+		return "0"
+	case defaultKeywords[strings.ToUpper(v)], strings.HasPrefix(v, "'"), strings.HasPrefix(v, "("):
+		return v
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return v
+	}
+	return d.quoteString(v)
+}
+
+func (d Dialect) quoteColumns(cols []string) string {
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = d.Quote(col)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+	nullTypes = map[reflect.Type]reflect.Type{
+		reflect.TypeOf(sql.NullString{}):  reflect.TypeOf(""),
+		reflect.TypeOf(sql.NullInt64{}):   reflect.TypeOf(int64(0)),
+		reflect.TypeOf(sql.NullInt32{}):   reflect.TypeOf(int32(0)),
+		reflect.TypeOf(sql.NullInt16{}):   reflect.TypeOf(int16(0)),
+		reflect.TypeOf(sql.NullByte{}):    reflect.TypeOf(byte(0)),
+		reflect.TypeOf(sql.NullBool{}):    reflect.TypeOf(false),
+		reflect.TypeOf(sql.NullFloat64{}): reflect.TypeOf(float64(0)),
+		reflect.TypeOf(sql.NullTime{}):    timeType,
+	}
+)
+
+// columnType maps the Go type of a column to a type of the dialect, unless
+// the column has a type: option.
+func (d Dialect) columnType(def columnDef) (string, error) {
+	if def.typ != "" {
+		if def.size > 0 {
+			return def.typ + "(" + strconv.Itoa(def.size) + ")", nil
+		}
+		return def.typ, nil
+	}
+
+	t := def.goType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if nt, ok := nullTypes[t]; ok {
+		t = nt
+	}
+	size := def.size
+
+	switch {
+	case t == timeType:
+		switch d {
+		case Postgres:
+			return "TIMESTAMP WITH TIME ZONE", nil
+		case SQLServer:
+			return "DATETIME2", nil
+		}
+		return "DATETIME", nil
+	case t == bytesType:
+		switch d {
+		case Postgres:
+			return "BYTEA", nil
+		case SQLServer:
+			if size > 0 {
+				return "VARBINARY(" + strconv.Itoa(size) + ")", nil
+			}
+			return "VARBINARY(MAX)", nil
+		case MySQL:
+			if size > 0 {
+				return "VARBINARY(" + strconv.Itoa(size) + ")", nil
+			}
+		}
+		return "BLOB", nil
+	}
+
+	unsigned := ""
+	if d == MySQL {
+		unsigned = " UNSIGNED"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		switch d {
+		case MySQL, Postgres:
+			return "BOOLEAN", nil
+		case SQLServer:
+			return "BIT", nil
+		}
+		return "INTEGER", nil
+	case reflect.Int8:
+		if d == MySQL {
+			return "TINYINT", nil
+		}
+		return d.integer("SMALLINT"), nil
+	case reflect.Uint8:
+		switch d {
+		case MySQL:
+			return "TINYINT UNSIGNED", nil
+		case SQLServer:
+			return "TINYINT", nil
+		}
+		return d.integer("SMALLINT"), nil
+	case reflect.Int16:
+		return d.integer("SMALLINT"), nil
+	case reflect.Uint16:
+		if d == MySQL {
+			return "SMALLINT UNSIGNED", nil
+		}
+		return d.integer("INTEGER"), nil
+	case reflect.Int32:
+		return d.integer("INTEGER"), nil
+	case reflect.Uint32:
+		if d == MySQL {
+			return "INT UNSIGNED", nil
+		}
+		return d.integer("BIGINT"), nil
+	case reflect.Int, reflect.Int64:
+		return d.integer("BIGINT"), nil
+	case reflect.Uint, reflect.Uint64:
+		return d.integer("BIGINT") + unsigned, nil
+	case reflect.Float32:
+		if d == MySQL {
+			return "FLOAT", nil
+		}
+		return "REAL", nil
+	case reflect.Float64:
+		switch d {
+		case Postgres:
+			return "DOUBLE PRECISION", nil
+		case SQLite:
+			return "REAL", nil
+		case SQLServer:
+			return "FLOAT", nil
+		}
+		return "DOUBLE", nil
+	case reflect.String:
+		if size <= 0 {
+			size = 255
+		}
+		switch d {
+		case SQLite:
+			return "TEXT", nil
+		case SQLServer:
+			return "NVARCHAR(" + strconv.Itoa(size) + ")", nil
+		}
+		return "VARCHAR(" + strconv.Itoa(size) + ")", nil
+	}
+	return "", fmt.Errorf("no column type for %s, set one with type:", def.goType)
+}
+
+// integer returns the integer type name of the dialect; SQLite only has
+// INTEGER.
+func (d Dialect) integer(name string) string {
+	if d == SQLite {
+		return "INTEGER"
+	}
+	if d == MySQL && name == "INTEGER" {
+		return "INT"
+	}
+	return name
+}
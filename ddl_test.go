@@ -0,0 +1,124 @@
+package torm
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ddlAuthor struct {
+	ID        int64     `db:"id" torm:"autoIncrement"`
+	Email     string    `db:"email" torm:"size:191;notNull;unique"`
+	Name      string    `db:"name" torm:"index"`
+	Active    bool      `db:"active" torm:"default:true"`
+	CreatedAt time.Time `db:"created_at" torm:"autoCreateTime"`
+}
+
+func (ddlAuthor) TableName() string { return "ddl_authors" }
+
+type ddlPost struct {
+	ID       int64          `db:"id" torm:"primaryKey"`
+	AuthorID int64          `db:"author_id" torm:"references:ddl_authors;index:idx_posts_author_slug"`
+	Slug     string         `db:"slug" torm:"size:64;index:idx_posts_author_slug"`
+	Body     sql.NullString `db:"body" torm:"type:TEXT"`
+	Score    *float64       `db:"score"`
+	Raw      []byte         `db:"raw"`
+}
+
+func (ddlPost) TableName() string { return "ddl_posts" }
+
+func TestCreateTables(t *testing.T) {
+	Register(ddlAuthor{})
+	Register(ddlPost{})
+
+	for _, c := range []struct {
+		d    Dialect
+		want []string
+	}{
+		{MySQL, []string{
+			"CREATE TABLE `ddl_authors` (\n  `id` BIGINT AUTO_INCREMENT NOT NULL,\n  `email` VARCHAR(191) NOT NULL UNIQUE,\n  `name` VARCHAR(255),\n  `active` BOOLEAN DEFAULT true,\n  `created_at` DATETIME,\n  PRIMARY KEY (`id`)\n)",
+			"CREATE INDEX `idx_ddl_authors_name` ON `ddl_authors` (`name`)",
+			"CREATE TABLE `ddl_posts` (\n  `id` BIGINT NOT NULL,\n  `author_id` BIGINT,\n  `slug` VARCHAR(64),\n  `body` TEXT,\n  `score` DOUBLE,\n  `raw` BLOB,\n  PRIMARY KEY (`id`),\n  FOREIGN KEY (`author_id`) REFERENCES `ddl_authors` (`id`)\n)",
+			"CREATE INDEX `idx_posts_author_slug` ON `ddl_posts` (`author_id`, `slug`)",
+		}},
+		{Postgres, []string{
+			`CREATE TABLE "ddl_authors" (` + "\n" + `  "id" BIGINT GENERATED BY DEFAULT AS IDENTITY NOT NULL,` + "\n" + `  "email" VARCHAR(191) NOT NULL UNIQUE,` + "\n" + `  "name" VARCHAR(255),` + "\n" + `  "active" BOOLEAN DEFAULT true,` + "\n" + `  "created_at" TIMESTAMP WITH TIME ZONE,` + "\n" + `  PRIMARY KEY ("id")` + "\n)",
+			`CREATE INDEX "idx_ddl_authors_name" ON "ddl_authors" ("name")`,
+			`CREATE TABLE "ddl_posts" (` + "\n" + `  "id" BIGINT NOT NULL,` + "\n" + `  "author_id" BIGINT,` + "\n" + `  "slug" VARCHAR(64),` + "\n" + `  "body" TEXT,` + "\n" + `  "score" DOUBLE PRECISION,` + "\n" + `  "raw" BYTEA,` + "\n" + `  PRIMARY KEY ("id"),` + "\n" + `  FOREIGN KEY ("author_id") REFERENCES "ddl_authors" ("id")` + "\n)",
+			`CREATE INDEX "idx_posts_author_slug" ON "ddl_posts" ("author_id", "slug")`,
+		}},
+		{SQLite, []string{
+			`CREATE TABLE "ddl_authors" (` + "\n" + `  "id" INTEGER PRIMARY KEY AUTOINCREMENT,` + "\n" + `  "email" TEXT NOT NULL UNIQUE,` + "\n" + `  "name" TEXT,` + "\n" + `  "active" INTEGER DEFAULT 1,` + "\n" + `  "created_at" DATETIME` + "\n)",
+		}},
+		{SQLServer, []string{
+			"CREATE TABLE [ddl_authors] (\n  [id] BIGINT IDENTITY(1,1) NOT NULL,\n  [email] NVARCHAR(191) NOT NULL UNIQUE,\n  [name] NVARCHAR(255),\n  [active] BIT DEFAULT 1,\n  [created_at] DATETIME2,\n  PRIMARY KEY ([id])\n)",
+		}},
+	} {
+		// posts are given first but come after the authors they reference.
+		got, err := CreateTables(c.d, "ddl_posts", "ddl_authors")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 4 {
+			t.Fatalf("%s: got %d statements, want 4", c.d, len(got))
+		}
+		if !reflect.DeepEqual(got[:len(c.want)], c.want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.d, strings.Join(got, ";\n"), strings.Join(c.want, ";\n"))
+		}
+	}
+}
+
+type ddlUnknown struct {
+	Tags map[string]string `db:"tags"`
+}
+
+func (ddlUnknown) TableName() string { return "ddl_unknown" }
+
+func TestCreateTablesUnknownType(t *testing.T) {
+	Register(ddlUnknown{})
+	if _, err := CreateTables(MySQL, "ddl_unknown"); err == nil || !strings.Contains(err.Error(), "ddl_unknown.tags") {
+		t.Errorf("got %v, want an error naming the column", err)
+	}
+}
+
+type ddlBadSize struct {
+	Name string `db:"name" torm:"size:big"`
+}
+
+func (ddlBadSize) TableName() string { return "ddl_bad_size" }
+
+func TestCreateTablesBadSize(t *testing.T) {
+	// the tag only matters to the DDL, so Register accepts it.
+	Register(ddlBadSize{})
+	defer delete(metas, "ddl_bad_size")
+	_, err := CreateTables(MySQL, "ddl_bad_size")
+	if err == nil || !strings.Contains(err.Error(), `ddl_bad_size.name: size must be a positive integer, got "big"`) {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestDefaultValue(t *testing.T) {
+	for _, c := range []struct {
+		d     Dialect
+		value string
+		want  string
+	}{
+		{MySQL, "true", "true"},
+		{SQLServer, "TRUE", "1"},
+		{SQLite, "false", "0"},
+		{Postgres, "-1.5", "-1.5"},
+		{MySQL, "current_timestamp", "current_timestamp"},
+		{Postgres, "NULL", "NULL"},
+		{Postgres, "'draft'", "'draft'"},
+		{Postgres, "(now() + interval '1 day')", "(now() + interval '1 day')"},
+		{Postgres, "hello", "'hello'"},
+		{MySQL, `it's`, `'it''s'`},
+		{SQLServer, "hello", "N'hello'"},
+	} {
+		if got := c.d.defaultValue(c.value); got != c.want {
+			t.Errorf("%s: defaultValue(%q) is %s, want %s", c.d, c.value, got, c.want)
+		}
+	}
+}
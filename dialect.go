@@ -0,0 +1,88 @@
+package torm
+
+import (
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect identifies the SQL flavour that statements are generated for.
+type Dialect string
+
+const (
+	MySQL     Dialect = "mysql"
+	Postgres  Dialect = "postgres"
+	SQLite    Dialect = "sqlite3"
+	SQLServer Dialect = "sqlserver"
+)
+
+type driverNamer interface {
+	DriverName() string
+}
+
+// dialectOf guesses the dialect from the driver name of h. Anything that is
+// not recognized is treated as MySQL, which is what torm has always emitted.
+func dialectOf(h interface{}) Dialect {
+	n, ok := h.(driverNamer)
+	if !ok {
+		return MySQL
+	}
+	name := n.DriverName()
+	switch {
+	case sqlx.BindType(name) == sqlx.DOLLAR:
+		return Postgres
+	case sqlx.BindType(name) == sqlx.AT:
+		return SQLServer
+	case strings.Contains(name, "sqlite"):
+		return SQLite
+	default:
+		return MySQL
+	}
+}
+
+// Quote quotes ident as an identifier.
+func (d Dialect) Quote(ident string) string {
+	switch d {
+	case Postgres, SQLite:
+		return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+	case SQLServer:
+		return "[" + strings.ReplaceAll(ident, "]", "]]") + "]"
+	default:
+		return "`" + strings.ReplaceAll(ident, "`", "``") + "`"
+	}
+}
+
+func (d Dialect) savepoint(name string) string {
+	if d == SQLServer {
+		return "SAVE TRANSACTION " + name
+	}
+	return "SAVEPOINT " + name
+}
+
+func (d Dialect) rollbackTo(name string) string {
+	if d == SQLServer {
+		return "ROLLBACK TRANSACTION " + name
+	}
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+// releaseSavepoint returns "" for dialects that have no way to release a
+// savepoint; it is simply discarded with the transaction there.
+func (d Dialect) releaseSavepoint(name string) string {
+	if d == SQLServer {
+		return ""
+	}
+	return "RELEASE SAVEPOINT " + name
+}
+
+func rebind(h handler, query string) string {
+	if h == nil {
+		return query
+	}
+	return h.Rebind(query)
+}
+
+// DialectOf returns the dialect torm generates statements in for db.
+func DialectOf(db interface{}) Dialect {
+	return dialectOf(db)
+}
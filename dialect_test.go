@@ -0,0 +1,41 @@
+package torm
+
+import (
+	"testing"
+)
+
+func TestDialectQuote(t *testing.T) {
+	for _, c := range []struct {
+		d    Dialect
+		want string
+	}{
+		{MySQL, "`a``b`"},
+		{Postgres, "\"a`b\""},
+		{SQLServer, "[a`b]"},
+	} {
+		if q := c.d.Quote("a`b"); q != c.want {
+			t.Errorf("%s: quoted is %s, %s was expected", c.d, q, c.want)
+		}
+	}
+}
+
+func TestDialectSavepoint(t *testing.T) {
+	for _, c := range []struct {
+		d                       Dialect
+		save, rollback, release string
+	}{
+		{MySQL, "SAVEPOINT sp", "ROLLBACK TO SAVEPOINT sp", "RELEASE SAVEPOINT sp"},
+		{Postgres, "SAVEPOINT sp", "ROLLBACK TO SAVEPOINT sp", "RELEASE SAVEPOINT sp"},
+		{SQLServer, "SAVE TRANSACTION sp", "ROLLBACK TRANSACTION sp", ""},
+	} {
+		if q := c.d.savepoint("sp"); q != c.save {
+			t.Errorf("%s: savepoint is %q", c.d, q)
+		}
+		if q := c.d.rollbackTo("sp"); q != c.rollback {
+			t.Errorf("%s: rollback is %q", c.d, q)
+		}
+		if q := c.d.releaseSavepoint("sp"); q != c.release {
+			t.Errorf("%s: release is %q", c.d, q)
+		}
+	}
+}
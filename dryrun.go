@@ -0,0 +1,368 @@
+package torm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DryRun records the statements of builders created WithDryRun instead of
+// running them.
+type DryRun struct {
+	// Dialect is the one statements are generated for and Script renders
+	// literals for.
+	Dialect Dialect
+
+	mu    sync.Mutex
+	stmts []DryRunStatement
+	once  sync.Once
+	db    *sqlx.DB
+}
+
+// DryRunStatement is a recorded statement with positional arguments.
+// Statements that begin and end transactions and savepoints have a zero Op.
+type DryRunStatement struct {
+	Op    Op
+	Query string
+	Args  []interface{}
+}
+
+func NewDryRun(d Dialect) *DryRun {
+	return &DryRun{Dialect: d}
+}
+
+// WithDryRun records every statement of the builder in r and returns a
+// result with no rows instead of running it. Interceptors given after it
+// are not run. The builder runs on r.DB instead of the handler it was
+// created with, so its transactions are recorded rather than begun.
+func WithDryRun(r *DryRun) Option {
+	intercept := WithInterceptors(func(ctx context.Context, op Op, sql *SQL, next Invoker) (Result, error) {
+		if err := r.record(op, sql); err != nil {
+			return Result{Rows: -1}, err
+		}
+		return Result{Exec: driver.RowsAffected(0), Rows: 0}, nil
+	})
+	return func(b *Builder) {
+		b.h = r.DB()
+		intercept(b)
+	}
+}
+
+// DB returns a handler that records the transactions begun on it, and the
+// statements run on it directly, like savepoints, in r. Queries return no
+// rows.
+func (r *DryRun) DB() *sqlx.DB {
+	r.once.Do(func() {
+		r.db = sqlx.NewDb(sql.OpenDB(dryRunConnector{r}), string(r.Dialect))
+	})
+	return r.db
+}
+
+func (r *DryRun) record(op Op, s *SQL) error {
+	query, args := s.Query, s.Args
+	if len(args) == 1 {
+		if schema, ok := args[0].(Schema); ok {
+			var err error
+			if query, args, err = sqlx.Named(query, schema); err != nil {
+				return err
+			}
+			query = sqlx.Rebind(sqlx.BindType(string(r.Dialect)), query)
+		}
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return fmt.Errorf("torm: argument %d of %q: %w", i+1, query, err)
+		}
+		values[i] = v
+	}
+
+	r.append(DryRunStatement{Op: op, Query: query, Args: values})
+	return nil
+}
+
+func (r *DryRun) append(stmt DryRunStatement) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stmts = append(r.stmts, stmt)
+}
+
+// txStatement returns the statement that begins, commits or rolls back a
+// transaction in the dialect of r.
+func (r *DryRun) txStatement(verb string) DryRunStatement {
+	if r.Dialect == SQLServer {
+		verb += " TRANSACTION"
+	}
+	return DryRunStatement{Query: verb}
+}
+
+// dryRunConnector is the driver behind DryRun.DB.
+type dryRunConnector struct{ r *DryRun }
+
+func (c dryRunConnector) Connect(context.Context) (driver.Conn, error) {
+	return dryRunConn(c), nil
+}
+
+func (c dryRunConnector) Driver() driver.Driver {
+	return dryRunDriver(c)
+}
+
+type dryRunDriver dryRunConnector
+
+func (d dryRunDriver) Open(string) (driver.Conn, error) {
+	return dryRunConn(d), nil
+}
+
+type dryRunConn dryRunConnector
+
+func (c dryRunConn) Prepare(query string) (driver.Stmt, error) {
+	return dryRunStmt{c.r, query}, nil
+}
+
+func (c dryRunConn) Close() error {
+	return nil
+}
+
+func (c dryRunConn) Begin() (driver.Tx, error) {
+	c.r.append(c.r.txStatement("BEGIN"))
+	return dryRunTx(c), nil
+}
+
+type dryRunTx dryRunConnector
+
+func (t dryRunTx) Commit() error {
+	t.r.append(t.r.txStatement("COMMIT"))
+	return nil
+}
+
+func (t dryRunTx) Rollback() error {
+	t.r.append(t.r.txStatement("ROLLBACK"))
+	return nil
+}
+
+type dryRunStmt struct {
+	r     *DryRun
+	query string
+}
+
+func (s dryRunStmt) Close() error {
+	return nil
+}
+
+func (s dryRunStmt) NumInput() int {
+	return -1
+}
+
+func (s dryRunStmt) Exec(args []driver.Value) (driver.Result, error) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	s.r.append(DryRunStatement{Query: s.query, Args: values})
+	return driver.RowsAffected(0), nil
+}
+
+func (s dryRunStmt) Query([]driver.Value) (driver.Rows, error) {
+	return dryRunRows{}, nil
+}
+
+type dryRunRows struct{}
+
+func (dryRunRows) Columns() []string {
+	return nil
+}
+
+func (dryRunRows) Close() error {
+	return nil
+}
+
+func (dryRunRows) Next([]driver.Value) error {
+	return io.EOF
+}
+
+// Statements returns the statements recorded so far.
+func (r *DryRun) Statements() []DryRunStatement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]DryRunStatement(nil), r.stmts...)
+}
+
+func (r *DryRun) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stmts = nil
+}
+
+// Script renders the recorded statements as a script, one statement per
+// line, with their arguments inlined as literals of the dialect.
+func (r *DryRun) Script() (string, error) {
+	var b strings.Builder
+	for _, stmt := range r.Statements() {
+		q, err := r.Dialect.Inline(stmt.Query, stmt.Args)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(q)
+		b.WriteString(";\n")
+	}
+	return b.String(), nil
+}
+
+// Inline replaces the placeholders of query, outside of quoted strings and
+// identifiers, with args rendered as literals.
+func (d Dialect) Inline(query string, args []interface{}) (string, error) {
+	var b strings.Builder
+	next := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			b.WriteByte(c)
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			b.WriteByte(c)
+			continue
+		case c == '[' && d == SQLServer:
+			quote = ']'
+			b.WriteByte(c)
+			continue
+		}
+
+		n, width := -1, 0
+		switch {
+		case c == '?' && (d == MySQL || d == SQLite):
+			n, width = next, 1
+			next++
+		case c == '$' && d == Postgres:
+			n, width = placeholderIndex(query[i+1:])
+		case c == '@' && d == SQLServer && strings.HasPrefix(query[i+1:], "p"):
+			n, width = placeholderIndex(query[i+2:])
+			width++
+		}
+		if n < 0 {
+			b.WriteByte(c)
+			continue
+		}
+		if n >= len(args) {
+			return "", fmt.Errorf("torm: %q has more placeholders than its %d arguments", query, len(args))
+		}
+		lit, err := d.literal(args[n])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(lit)
+		i += width - 1
+	}
+	return b.String(), nil
+}
+
+// placeholderIndex parses the number of a $N or @pN placeholder at the
+// start of s. It returns the zero based index and the width of the
+// placeholder including its prefix, or -1 when there is none.
+func placeholderIndex(s string) (int, int) {
+	end := 0
+	for end < len(s) && '0' <= s[end] && s[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(s[:end])
+	if err != nil || n < 1 {
+		return -1, 0
+	}
+	return n - 1, end + 1
+}
+
+// literal renders v, a driver.Value, as a SQL literal.
+func (d Dialect) literal(v interface{}) (string, error) {
+	v, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case bool:
+		switch {
+		case d == SQLite || d == SQLServer:
+			if v {
+				return "1", nil
+			}
+			return "0", nil
+		case v:
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case string:
+		return d.quoteString(v), nil
+	case []byte:
+		switch d {
+		case Postgres:
+			return `'\x` + hex.EncodeToString(v) + `'::bytea`, nil
+		case SQLServer:
+			return "0x" + hex.EncodeToString(v), nil
+		}
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case time.Time:
+		switch d {
+		case MySQL:
+			// DATETIME has no time zone; the mysql driver sends times in UTC
+			// unless its loc parameter says otherwise.
+			return "'" + v.UTC().Format("2006-01-02 15:04:05.999999") + "'", nil
+		case SQLServer:
+			return "'" + v.Format("2006-01-02T15:04:05.9999999-07:00") + "'", nil
+		}
+		return "'" + v.Format("2006-01-02 15:04:05.999999999-07:00") + "'", nil
+	}
+	return "", fmt.Errorf("torm: can't inline %T", v)
+}
+
+// quoteString quotes s as a string literal. MySQL also interprets
+// backslash escapes in strings, so those are escaped as well.
+func (d Dialect) quoteString(s string) string {
+	switch d {
+	case MySQL:
+		var b strings.Builder
+		b.WriteByte('\'')
+		for i := 0; i < len(s); i++ {
+			switch c := s[i]; c {
+			case '\'':
+				b.WriteString(`''`)
+			case '\\':
+				b.WriteString(`\\`)
+			case 0:
+				b.WriteString(`\0`)
+			case '\n':
+				b.WriteString(`\n`)
+			case '\r':
+				b.WriteString(`\r`)
+			case 0x1a:
+				b.WriteString(`\Z`)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte('\'')
+		return b.String()
+	case SQLServer:
+		return "N'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
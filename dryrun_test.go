@@ -0,0 +1,131 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/pinnacles/torm/internal/test"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	tm := time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC)
+	r := NewDryRun(MySQL)
+	builder := NewBuilder(nil, WithDryRun(r))
+	builder.SetTime(&tm)
+
+	res, err := builder.Insert("foo").Exec(ctx, &test.TestSchema{Foo: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 0 {
+		t.Errorf("got %d rows affected, want 0", n)
+	}
+	if _, err := builder.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 2}); err != nil {
+		t.Fatal(err)
+	}
+	rows := []test.TestSchema{}
+	if err := builder.Select("foo").Where("foo IN (:foo)", KV{"foo": []int{1, 2}}).Query(ctx, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("got %d rows, want none", len(rows))
+	}
+
+	stmts := r.Statements()
+	if len(stmts) != 3 || stmts[0].Op.Kind != OpInsert || stmts[1].Op.Kind != OpDelete || stmts[2].Op.Kind != OpSelect {
+		t.Fatalf("unexpected statements %+v", stmts)
+	}
+	script, err := r.Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "INSERT INTO `test` (`foo`,`created_at`,`updated_at`) VALUES (1,'2026-10-01 12:30:00','2026-10-01 12:30:00');\n" +
+		"DELETE FROM `test` WHERE foo = 2;\n" +
+		"SELECT `foo` FROM `test` WHERE foo IN (1, 2);\n"
+	if script != want {
+		t.Errorf("got script\n%s\nwant\n%s", script, want)
+	}
+
+	r.Reset()
+	if len(r.Statements()) != 0 {
+		t.Error("Reset kept statements")
+	}
+}
+
+func TestDryRunTransaction(t *testing.T) {
+	ctx := context.Background()
+	r := NewDryRun(MySQL)
+	builder := NewBuilder(nil, WithDryRun(r))
+
+	err := builder.Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+		if _, err := b.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+			return err
+		}
+		if err := b.Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+			return errors.New("fail")
+		}); err == nil {
+			t.Error("expected the savepoint to fail")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+		return errors.New("fail")
+	}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	script, err := r.Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "BEGIN;\n" +
+		"DELETE FROM `test` WHERE foo = 1;\n" +
+		"SAVEPOINT torm_sp_\\d+;\n" +
+		"ROLLBACK TO SAVEPOINT torm_sp_\\d+;\n" +
+		"COMMIT;\n" +
+		"BEGIN;\n" +
+		"ROLLBACK;\n"
+	if !regexp.MustCompile("^" + want + "$").MatchString(script) {
+		t.Errorf("got script\n%s", script)
+	}
+}
+
+func TestDialectInline(t *testing.T) {
+	tm := time.Date(2026, 10, 1, 12, 30, 0, 500, time.FixedZone("", 9*3600))
+	for _, c := range []struct {
+		d     Dialect
+		query string
+		args  []interface{}
+		want  string
+	}{
+		{MySQL, "SELECT * FROM t WHERE a = ? AND b = '?' AND c = ?", []interface{}{`it's \ "x"`, nil}, `SELECT * FROM t WHERE a = 'it''s \\ "x"' AND b = '?' AND c = NULL`},
+		{MySQL, "UPDATE t SET a = ?, b = ?, c = ?", []interface{}{true, []byte{0xde, 0xad}, tm}, "UPDATE t SET a = TRUE, b = X'dead', c = '2026-10-01 03:30:00'"},
+		{Postgres, `SELECT * FROM t WHERE a = $2 AND b = $1 AND "$1" = $10`, []interface{}{1.5, "x", 3, 4, 5, 6, 7, 8, 9, int64(10)}, `SELECT * FROM t WHERE a = 'x' AND b = 1.5 AND "$1" = 10`},
+		{Postgres, "INSERT INTO t VALUES ($1, $2, $3)", []interface{}{[]byte{1}, false, tm}, `INSERT INTO t VALUES ('\x01'::bytea, FALSE, '2026-10-01 12:30:00.0000005+09:00')`},
+		{SQLite, "SELECT ? , ?", []interface{}{true, `a\b`}, `SELECT 1 , 'a\b'`},
+		{SQLServer, "SELECT [@p1] FROM t WHERE a = @p1 AND b = @p2", []interface{}{"é'", []byte{0xff}}, "SELECT [@p1] FROM t WHERE a = N'é''' AND b = 0xff"},
+	} {
+		got, err := c.d.Inline(c.query, c.args)
+		if err != nil {
+			t.Errorf("%s %q: %v", c.d, c.query, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.d, got, c.want)
+		}
+	}
+
+	if _, err := MySQL.Inline("SELECT ?, ?", []interface{}{1}); err == nil {
+		t.Error("expected an error for a missing argument")
+	}
+	if _, err := MySQL.Inline("SELECT ?", []interface{}{struct{}{}}); err == nil {
+		t.Error("expected an error for an unsupported argument")
+	}
+}
@@ -43,26 +43,23 @@ func main() {
 
 	builder := torm.NewBuilder(db)
 
-	must(torm.Transaction(context.Background(), nil, db, func(tx *sqlx.Tx) error {
-		builder := torm.NewBuilder(tx)
-		must(insertUser(builder))
-		must(insertUsers(builder))
+	must(builder.Transaction(context.Background(), nil, func(ctx context.Context, builder *torm.Builder) error {
+		must(insertUser(ctx, builder))
+		must(insertUsers(ctx, builder))
 		return nil
 	}))
 	must(printUsers(builder))
 
-	must(torm.Transaction(context.Background(), nil, db, func(tx *sqlx.Tx) error {
-		builder := torm.NewBuilder(tx)
-		must(updateUser(builder))
-		must(updateUsers(builder))
+	must(builder.Transaction(context.Background(), nil, func(ctx context.Context, builder *torm.Builder) error {
+		must(updateUser(ctx, builder))
+		must(updateUsers(ctx, builder))
 		return nil
 	}))
 	must(printUsers(builder))
 
-	must(torm.Transaction(context.Background(), nil, db, func(tx *sqlx.Tx) error {
-		builder := torm.NewBuilder(tx)
-		must(deleteUser(builder))
-		must(deleteUsers(builder))
+	must(builder.Transaction(context.Background(), nil, func(ctx context.Context, builder *torm.Builder) error {
+		must(deleteUser(ctx, builder))
+		must(deleteUsers(ctx, builder))
 		return nil
 	}))
 	must(printUsers(builder))
@@ -89,8 +86,7 @@ func printUsers(builder *torm.Builder) error {
 	return nil
 }
 
-func insertUser(builder *torm.Builder) error {
-	ctx := context.Background()
+func insertUser(ctx context.Context, builder *torm.Builder) error {
 	user := User{
 		Name:  "foo",
 		Email: "foo@example.com",
@@ -100,8 +96,7 @@ func insertUser(builder *torm.Builder) error {
 	return err
 }
 
-func insertUsers(builder *torm.Builder) error {
-	ctx := context.Background()
+func insertUsers(ctx context.Context, builder *torm.Builder) error {
 	users := []User{
 		{
 			Name:  "bar",
@@ -122,8 +117,7 @@ func insertUsers(builder *torm.Builder) error {
 	return nil
 }
 
-func updateUser(builder *torm.Builder) error {
-	ctx := context.Background()
+func updateUser(ctx context.Context, builder *torm.Builder) error {
 	user := User{}
 	if err := builder.Select().Where("name=:name", torm.KV{"name": "foo"}).Query(ctx, &user); err != nil {
 		return err
@@ -133,8 +127,7 @@ func updateUser(builder *torm.Builder) error {
 	return err
 }
 
-func updateUsers(builder *torm.Builder) error {
-	ctx := context.Background()
+func updateUsers(ctx context.Context, builder *torm.Builder) error {
 	users := []User{}
 	if err := builder.Select().Where("name LIKE 'b%' AND age<=:age", torm.KV{"age": 20}).Query(ctx, &users); err != nil {
 		return err
@@ -150,8 +143,7 @@ func updateUsers(builder *torm.Builder) error {
 	return nil
 }
 
-func deleteUser(builder *torm.Builder) error {
-	ctx := context.Background()
+func deleteUser(ctx context.Context, builder *torm.Builder) error {
 	user := User{}
 	if err := builder.Select().Where("name=:name", torm.KV{"name": "foo"}).Query(ctx, &user); err != nil {
 		return err
@@ -160,8 +152,7 @@ func deleteUser(builder *torm.Builder) error {
 	return err
 }
 
-func deleteUsers(builder *torm.Builder) error {
-	ctx := context.Background()
+func deleteUsers(ctx context.Context, builder *torm.Builder) error {
 	users := []User{}
 	if err := builder.Select().Query(ctx, &users); err != nil {
 		return err
@@ -3,250 +3,298 @@ package torm
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"reflect"
-	"strings"
-	"time"
 
 	"github.com/jmoiron/sqlx"
-	log "github.com/sirupsen/logrus"
 )
 
 type insertBuilder struct {
-	h      handler
+	t      *Builder
 	fields []string
-	ts     *time.Time
+	table  string
 }
 
-func newInsert(h handler, ts *time.Time, f ...string) *insertBuilder {
+func newInsert(t *Builder, f ...string) *insertBuilder {
 	return &insertBuilder{
-		h:      h,
-		fields: f,
-		ts:     ts,
+		t:      t,
+		fields: cloneFields(f),
 	}
 }
 
+// Table makes the statement use the table name instead of the one of the
+// schema, whose registration is still used.
+func (b *insertBuilder) Table(name string) *insertBuilder {
+	c := *b
+	c.table = name
+	return &c
+}
+
+// ToSQL is ToSQLContext with context.Background(), under which
+// TableNameFor and tenant scoping see no context values; the SQL can differ
+// from the one Exec runs with its ctx.
 func (b *insertBuilder) ToSQL(s Schema) (*SQL, error) {
-	meta := metas[s.TableName()]
+	return b.toSQL(context.Background(), s)
+}
 
-	autoCreateTimeCol := map[string]bool{}
-	autoUpdateTimeCol := map[string]bool{}
-	if len(b.fields) <= 0 {
-		fs := []string{}
-		for _, field := range meta.Fields {
-			if meta.IsAutoIncrement(field) {
-				continue
-			}
-			fs = append(fs, field)
-		}
-		b.fields = fs
-	} else {
-		for _, field := range b.fields {
-			if meta.IsAutoCreateTime(field) {
-				autoCreateTimeCol[field] = true
-				continue
-			}
-			if meta.IsAutoUpdateTime(field) {
-				autoUpdateTimeCol[field] = true
-				continue
-			}
-		}
-		for field := range meta.AutoCreateTimeColumns {
-			if _, ok := autoCreateTimeCol[field]; !ok {
-				b.fields = append(b.fields, field)
-			}
-		}
-		for field := range meta.AutoUpdateTimeColumns {
-			if _, ok := autoUpdateTimeCol[field]; !ok {
-				b.fields = append(b.fields, field)
-			}
-		}
-	}
+// ToSQLContext returns the statement Exec runs with ctx.
+func (b *insertBuilder) ToSQLContext(ctx context.Context, s Schema) (*SQL, error) {
+	return b.toSQL(ctx, s)
+}
 
-	ts := time.Now()
-	if b.ts != nil {
-		ts = *b.ts
-	}
-	elem := dereference(reflect.ValueOf(s))
-	for k, v := range meta.AutoCreateTimeColumns {
-		if _, ok := autoCreateTimeCol[k]; !ok {
-			f := elem.FieldByName(v)
-			if f.IsValid() && f.CanSet() && f.Kind() == reflect.Struct {
-				f.Set(reflect.ValueOf(ts))
-			}
-		}
-	}
-	for k, v := range meta.AutoUpdateTimeColumns {
-		if _, ok := autoUpdateTimeCol[k]; !ok {
-			f := elem.FieldByName(v)
-			if f.IsValid() && f.CanSet() && f.Kind() == reflect.Struct {
-				f.Set(reflect.ValueOf(ts))
-			}
+func (b *insertBuilder) toSQL(ctx context.Context, s Schema) (*SQL, error) {
+	meta := metas[s.TableName()]
+	if meta.tenant != nil {
+		if err := meta.setTenant(ctx, s); err != nil {
+			return nil, err
 		}
 	}
+	table := tableName(ctx, b.table, s)
+	p := meta.plan(insertPlan, dialectOf(b.t.base(meta)), table, b.fields)
+	meta.stamp(s, p.stamp, b.t.ts)
 
-	names := make([]string, 0, len(b.fields))
-	for i, n := range b.fields {
-		b.fields[i] = fmt.Sprintf("`%s`", n)
-		names = append(names, ":"+n)
-	}
-	syntax := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s)", meta.TableName, strings.Join(b.fields, ","), strings.Join(names, ","))
-
-	log.Infof("SQL: %s value: %#v", syntax, s)
 	return &SQL{
-		Query: syntax,
+		Query: p.query,
 		Args:  []interface{}{s},
+		op:    newOp(OpInsert, meta, table, p.columns),
 	}, nil
 }
 
 func (b *insertBuilder) Exec(ctx context.Context, s Schema) (sql.Result, error) {
-	sql, err := b.ToSQL(s)
+	sql, err := b.toSQL(ctx, s)
 	if err != nil {
 		return nil, err
 	}
-	return b.h.NamedExecContext(ctx, sql.Query, s)
+	h, err := b.t.schemaTarget(ctx, metas[s.TableName()], s)
+	if err != nil {
+		return nil, err
+	}
+	return b.t.namedExec(ctx, h, sql)
 }
 
 type updateBuilder struct {
-	h      handler
+	t      *Builder
 	fields []string
-	ts     *time.Time
+	table  string
 }
 
-func newUpdate(h handler, ts *time.Time, f ...string) *updateBuilder {
+func newUpdate(t *Builder, f ...string) *updateBuilder {
 	return &updateBuilder{
-		h:      h,
-		fields: f,
-		ts:     ts,
+		t:      t,
+		fields: cloneFields(f),
 	}
 }
 
+// Table makes the statement use the table name instead of the one of the
+// schema, whose registration is still used.
+func (b *updateBuilder) Table(name string) *updateBuilder {
+	c := *b
+	c.table = name
+	return &c
+}
+
 func (b *updateBuilder) Where(clause string) *execUpdateBuilder {
 	return &execUpdateBuilder{
-		h:      b.h,
+		t:      b.t,
 		fields: b.fields,
 		clause: clause,
-		ts:     b.ts,
+		table:  b.table,
+	}
+}
+
+// All updates every row of the table, which Where("") refuses to do.
+func (b *updateBuilder) All() *execUpdateBuilder {
+	return &execUpdateBuilder{
+		t:      b.t,
+		fields: b.fields,
+		table:  b.table,
+		all:    true,
 	}
 }
 
 type execUpdateBuilder struct {
-	h      handler
+	t      *Builder
 	fields []string
 	clause string
-	ts     *time.Time
+	table  string
+	all    bool
 }
 
+func (b *execUpdateBuilder) Table(name string) *execUpdateBuilder {
+	c := *b
+	c.table = name
+	return &c
+}
+
+// ToSQL is ToSQLContext with context.Background(), under which
+// TableNameFor and tenant scoping see no context values; the SQL can differ
+// from the one Exec runs with its ctx.
 func (b *execUpdateBuilder) ToSQL(s Schema) (*SQL, error) {
-	meta := metas[s.TableName()]
+	return b.toSQL(context.Background(), s)
+}
 
-	autoUpdateTimeCol := map[string]bool{}
-	if len(b.fields) <= 0 {
-		fs := []string{}
-		for _, f := range meta.Fields {
-			if meta.IsAutoIncrement(f) {
-				continue
-			}
-			if meta.IsAutoCreateTime(f) {
-				continue
-			}
-			fs = append(fs, f)
-		}
-		b.fields = fs
-	} else {
-		for _, field := range b.fields {
-			if meta.IsAutoUpdateTime(field) {
-				autoUpdateTimeCol[field] = true
-			}
-		}
-		for filed := range meta.AutoUpdateTimeColumns {
-			if _, ok := autoUpdateTimeCol[filed]; !ok {
-				b.fields = append(b.fields, filed)
-			}
-		}
-	}
+// ToSQLContext returns the statement Exec runs with ctx.
+func (b *execUpdateBuilder) ToSQLContext(ctx context.Context, s Schema) (*SQL, error) {
+	return b.toSQL(ctx, s)
+}
 
-	ts := time.Now()
-	if b.ts != nil {
-		ts = *b.ts
+func (b *execUpdateBuilder) toSQL(ctx context.Context, s Schema) (*SQL, error) {
+	if err := b.t.guardWhere(b.clause, b.all); err != nil {
+		return nil, err
 	}
-	elem := dereference(reflect.ValueOf(s))
-	for k, v := range meta.AutoUpdateTimeColumns {
-		if _, ok := autoUpdateTimeCol[k]; !ok {
-			f := elem.FieldByName(v)
-			if f.IsValid() && f.CanSet() && f.Kind() == reflect.Struct {
-				f.Set(reflect.ValueOf(ts))
-			}
+	meta := metas[s.TableName()]
+	d := dialectOf(b.t.base(meta))
+	clause := b.clause
+	if meta.tenant != nil {
+		if err := meta.setTenant(ctx, s); err != nil {
+			return nil, err
 		}
+		clause = tenantClause(d, clause, meta.tenant.column, meta.tenant.column)
 	}
+	table := tableName(ctx, b.table, s)
+	p := meta.plan(updatePlan, d, table, b.fields)
+	meta.stamp(s, p.stamp, b.t.ts)
 
-	fields := make([]string, 0, len(b.fields))
-	for _, n := range b.fields {
-		fields = append(fields, fmt.Sprintf("`%s`=:%s", n, n))
-	}
-	syntax := []string{fmt.Sprintf("UPDATE `%s` SET %s", meta.TableName, strings.Join(fields, ","))}
-	if b.clause != "" {
-		syntax = append(syntax, fmt.Sprintf("WHERE %s", b.clause))
+	query := p.query
+	if clause != "" {
+		query += " WHERE " + clause
 	}
-	syntax = []string{strings.Join(syntax, " ")}
 
-	log.Infof("SQL: %s value: %#v", syntax[0], s)
 	return &SQL{
-		Query: syntax[0],
+		Query: query,
 		Args:  []interface{}{s},
+		op:    newOp(OpUpdate, meta, table, p.columns),
 	}, nil
 }
 
 func (b *execUpdateBuilder) Exec(ctx context.Context, s Schema) (sql.Result, error) {
-	sql, err := b.ToSQL(s)
+	sql, err := b.toSQL(ctx, s)
 	if err != nil {
 		return nil, err
 	}
-	return b.h.NamedExecContext(ctx, sql.Query, s)
+	h, err := b.t.whereTarget(ctx, metas[s.TableName()], s, b.clause)
+	if err != nil {
+		return nil, err
+	}
+	return b.t.namedExec(ctx, h, sql)
 }
 
 type deleteBuilder struct {
-	h handler
+	t     *Builder
+	table string
 }
 
-func newDelete(h handler) *deleteBuilder {
+func newDelete(t *Builder) *deleteBuilder {
 	return &deleteBuilder{
-		h: h,
+		t: t,
 	}
 }
 
+// Table makes the statement use the table name instead of the one of the
+// schema, whose registration is still used.
+func (b *deleteBuilder) Table(name string) *deleteBuilder {
+	c := *b
+	c.table = name
+	return &c
+}
+
 func (b *deleteBuilder) Where(clause string) *execDeleteBuilder {
 	return &execDeleteBuilder{
-		h:      b.h,
+		t:      b.t,
 		clause: clause,
+		table:  b.table,
+	}
+}
+
+// All deletes every row of the table, which Where("") refuses to do.
+func (b *deleteBuilder) All() *execDeleteBuilder {
+	return &execDeleteBuilder{
+		t:     b.t,
+		table: b.table,
+		all:   true,
 	}
 }
 
 type execDeleteBuilder struct {
-	h      handler
+	t      *Builder
 	clause string
+	table  string
+	all    bool
 }
 
+func (b *execDeleteBuilder) Table(name string) *execDeleteBuilder {
+	c := *b
+	c.table = name
+	return &c
+}
+
+// ToSQL is ToSQLContext with context.Background(), under which
+// TableNameFor and tenant scoping see no context values; the SQL can differ
+// from the one Exec runs with its ctx.
 func (b *execDeleteBuilder) ToSQL(s Schema) (*SQL, error) {
+	return b.toSQL(context.Background(), s)
+}
+
+// ToSQLContext returns the statement Exec runs with ctx.
+func (b *execDeleteBuilder) ToSQLContext(ctx context.Context, s Schema) (*SQL, error) {
+	return b.toSQL(ctx, s)
+}
+
+func (b *execDeleteBuilder) toSQL(ctx context.Context, s Schema) (*SQL, error) {
+	if err := b.t.guardWhere(b.clause, b.all); err != nil {
+		return nil, err
+	}
 	meta := metas[s.TableName()]
-	query, args, err := sqlx.Named(fmt.Sprintf("DELETE FROM `%s` WHERE %s", meta.TableName, b.clause), s)
+	d := dialectOf(b.t.base(meta))
+	clause := b.clause
+	if meta.tenant != nil {
+		if err := meta.setTenant(ctx, s); err != nil {
+			return nil, err
+		}
+		clause = tenantClause(d, clause, meta.tenant.column, meta.tenant.column)
+	}
+	table := tableName(ctx, b.table, s)
+	p := meta.plan(deletePlan, d, table, nil)
+	query := p.query
+	if clause != "" {
+		query += " WHERE " + clause
+	}
+	query, args, err := sqlx.Named(query, s)
 	if err != nil {
 		return nil, err
 	}
+	query = rebind(b.t.base(meta), query)
 
-	log.Infof("SQL: %s value: %#v", query, args)
-	return &SQL{
+	sql := &SQL{
 		Query: query,
 		Args:  args,
-	}, nil
+		op:    newOp(OpDelete, meta, table, nil),
+	}
+	if len(meta.sensitive) > 0 {
+		sql.sensitive = true
+		sql.mask = meta.argMask(clause, meta.columnNames(), false)
+	}
+	return sql, nil
 }
 
 func (b *execDeleteBuilder) Exec(ctx context.Context, s Schema) (sql.Result, error) {
-	sql, err := b.ToSQL(s)
+	sql, err := b.toSQL(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	h, err := b.t.whereTarget(ctx, metas[s.TableName()], s, b.clause)
 	if err != nil {
 		return nil, err
 	}
-	return b.h.ExecContext(ctx, sql.Query, sql.Args...)
+	return b.t.exec(ctx, h, sql)
+}
+
+// cloneFields copies f so that builders never share a backing array with
+// their caller or with each other.
+func cloneFields(f []string) []string {
+	if len(f) == 0 {
+		return nil
+	}
+	return append(make([]string, 0, len(f)), f...)
 }
 
 func dereference(v reflect.Value) reflect.Value {
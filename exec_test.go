@@ -3,6 +3,7 @@ package torm
 import (
 	"context"
 	"regexp"
+	"sync"
 	"testing"
 	"time"
 
@@ -132,3 +133,107 @@ func TestDelete(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestInsertReuse(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		tm := time.Now()
+		for i := 0; i < 2; i++ {
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `test` (`foo`,`created_at`,`updated_at`) VALUES (?,?,?)")).
+				WithArgs(1, tm, tm).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+
+		builder := NewBuilder(db)
+		builder.SetTime(&tm)
+		insert := builder.Insert("foo")
+		for i := 0; i < 2; i++ {
+			if _, err := insert.Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateReuse(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		tm := time.Now()
+		for i := 0; i < 2; i++ {
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `test` SET `bar`=?,`updated_at`=? WHERE foo = ?")).
+				WithArgs(2, tm, 1).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+
+		builder := NewBuilder(db)
+		builder.SetTime(&tm)
+		update := builder.Update("bar").Where("foo = :foo")
+		for i := 0; i < 2; i++ {
+			if _, err := update.Exec(ctx, &test.TestSchema{Foo: 1, Bar: 2}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInsertConcurrentToSQL(t *testing.T) {
+	insert := NewBuilder(nil).Insert("foo")
+	want := "INSERT INTO `test` (`foo`,`created_at`,`updated_at`) VALUES (:foo,:created_at,:updated_at)"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sql, err := insert.ToSQL(&test.TestSchema{Foo: 1})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if sql.Query != want {
+				t.Errorf("unexpected query: %s", sql.Query)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkInsertToSQL(b *testing.B) {
+	tm := time.Now()
+	builder := NewBuilder(nil)
+	builder.SetTime(&tm)
+	insert := builder.Insert("foo")
+	ts := &test.TestSchema{Foo: 1}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := insert.ToSQL(ts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUpdateToSQL(b *testing.B) {
+	tm := time.Now()
+	builder := NewBuilder(nil)
+	builder.SetTime(&tm)
+	update := builder.Update().Where("foo = :foo")
+	ts := &test.TestSchema{Foo: 1}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := update.ToSQL(ts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
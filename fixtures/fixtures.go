@@ -0,0 +1,321 @@
+// Package fixtures seeds test databases from YAML or JSON files keyed by
+// table name. Rows are mapped to the schemas registered with torm.Register
+// and inserted through torm builders. Rows of tenant tables are written
+// with the tenant column the file gives, whatever tenant ctx carries.
+//
+//	users:
+//	  - id: 1
+//	    name: alice
+//	    created_at: {{now}}
+//	posts:
+//	  - id: 1
+//	    user_id: 1
+package fixtures
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm"
+	"github.com/pinnacles/torm/internal/conv"
+	"gopkg.in/yaml.v3"
+)
+
+// Loader loads fixture files into a database and remembers the tables it
+// filled so that Truncate can empty them.
+type Loader struct {
+	db    *sqlx.DB
+	now   func() time.Time
+	funcs template.FuncMap
+
+	loaded map[string]struct{}
+}
+
+type Option func(*Loader)
+
+// WithNow sets the time {{now}} renders, time.Now by default.
+func WithNow(now func() time.Time) Option {
+	return func(l *Loader) {
+		l.now = now
+	}
+}
+
+// WithFuncs adds template functions to the ones fixture files can use.
+func WithFuncs(funcs template.FuncMap) Option {
+	return func(l *Loader) {
+		for name, fn := range funcs {
+			l.funcs[name] = fn
+		}
+	}
+}
+
+func New(db *sqlx.DB, opts ...Option) *Loader {
+	l := &Loader{
+		db:     db,
+		now:    time.Now,
+		funcs:  template.FuncMap{},
+		loaded: map[string]struct{}{},
+	}
+	l.funcs["now"] = func() string {
+		return l.now().Format(time.RFC3339Nano)
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Load inserts the rows of the files inside one transaction. Files are
+// templates, rendered before they are parsed as YAML, which JSON files are
+// too. Tables are filled in an order where the tables a table references
+// come first.
+func (l *Loader) Load(ctx context.Context, paths ...string) error {
+	rows := map[string][]map[string]interface{}{}
+	for _, path := range paths {
+		if err := l.parse(path, rows); err != nil {
+			return err
+		}
+	}
+
+	tables := make([]string, 0, len(rows))
+	for table := range rows {
+		tables = append(tables, table)
+	}
+	order, err := insertOrder(tables)
+	if err != nil {
+		return err
+	}
+
+	err = torm.NewBuilder(l.db).Transaction(ctx, nil, func(ctx context.Context, b *torm.Builder) error {
+		for _, info := range order {
+			for i, row := range rows[info.Name] {
+				if err := insert(ctx, b, info, row); err != nil {
+					return fmt.Errorf("fixtures: %s row %d: %w", info.Name, i+1, err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		l.loaded[table] = struct{}{}
+	}
+	return nil
+}
+
+func (l *Loader) parse(path string, rows map[string][]map[string]interface{}) error {
+	switch ext := filepath.Ext(path); ext {
+	case ".yml", ".yaml", ".json":
+	default:
+		return fmt.Errorf("fixtures: %s: unsupported extension %q", path, ext)
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(l.funcs).Parse(string(src))
+	if err != nil {
+		return fmt.Errorf("fixtures: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return fmt.Errorf("fixtures: %w", err)
+	}
+
+	file := map[string][]map[string]interface{}{}
+	if err := yaml.Unmarshal(buf.Bytes(), &file); err != nil {
+		return fmt.Errorf("fixtures: %s: %w", path, err)
+	}
+	for table, r := range file {
+		rows[table] = append(rows[table], r...)
+	}
+	return nil
+}
+
+// insertOrder returns the registrations of tables, the tables a table
+// references first.
+func insertOrder(tables []string) ([]torm.TableInfo, error) {
+	names, err := torm.ReferenceOrder(tables)
+	if err != nil {
+		return nil, fmt.Errorf("fixtures: %w", err)
+	}
+	order := make([]torm.TableInfo, len(names))
+	for i, name := range names {
+		order[i], _ = torm.Lookup(name)
+	}
+	return order, nil
+}
+
+func insert(ctx context.Context, b *torm.Builder, info torm.TableInfo, row map[string]interface{}) error {
+	v := reflect.New(info.Type)
+	s, ok := v.Interface().(torm.Schema)
+	if !ok {
+		return fmt.Errorf("%s is not a torm.Schema", v.Type())
+	}
+	fields := make([]string, 0, len(row))
+	for i, col := range info.Columns {
+		value, ok := row[col]
+		if !ok {
+			continue
+		}
+		if err := assign(v.Elem().FieldByIndex(info.Fields[i]), value); err != nil {
+			return fmt.Errorf("column %s: %w", col, err)
+		}
+		fields = append(fields, col)
+		if col == info.Tenant {
+			// the row is written with the tenant it gives rather than
+			// the one of ctx.
+			ctx = torm.WithTenant(ctx, v.Elem().FieldByIndex(info.Fields[i]).Interface())
+		}
+	}
+	if len(fields) != len(row) {
+		for col := range row {
+			if !contains(info.Columns, col) {
+				return fmt.Errorf("unknown column %s", col)
+			}
+		}
+	}
+	_, err := b.Insert(fields...).Exec(ctx, s)
+	return err
+}
+
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02"}
+
+// assign stores a value decoded from YAML in the struct field f.
+func assign(f reflect.Value, value interface{}) error {
+	if value == nil {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+	if scanner, ok := f.Addr().Interface().(sql.Scanner); ok {
+		return scanner.Scan(value)
+	}
+	if f.Kind() == reflect.Ptr {
+		p := reflect.New(f.Type().Elem())
+		if err := assign(p.Elem(), value); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	if s, ok := value.(string); ok && f.Type() == reflect.TypeOf(time.Time{}) {
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				f.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return fmt.Errorf("can't parse %q as a time", s)
+	}
+	if f.Kind() == reflect.String && v.Kind() != reflect.String {
+		return fmt.Errorf("can't store %T in %s", value, f.Type())
+	}
+	if f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Uint8 && v.Kind() == reflect.String {
+		f.SetBytes([]byte(v.String()))
+		return nil
+	}
+	if conv.IsNumber(v.Kind()) && conv.IsNumber(f.Kind()) {
+		c, ok := conv.Number(v, f.Type())
+		if !ok {
+			return fmt.Errorf("can't store %v in %s without losing precision", value, f.Type())
+		}
+		f.Set(c)
+		return nil
+	}
+	if !v.Type().ConvertibleTo(f.Type()) {
+		return fmt.Errorf("can't store %T in %s", value, f.Type())
+	}
+	f.Set(v.Convert(f.Type()))
+	return nil
+}
+
+// Truncate empties the tables filled by the loader, the referencing ones
+// first, and forgets them.
+func (l *Loader) Truncate(ctx context.Context) error {
+	tables := make([]string, 0, len(l.loaded))
+	for table := range l.loaded {
+		tables = append(tables, table)
+	}
+	if err := Truncate(ctx, l.db, tables...); err != nil {
+		return err
+	}
+	l.loaded = map[string]struct{}{}
+	return nil
+}
+
+// Truncate empties the registered tables, the referencing ones first.
+func Truncate(ctx context.Context, db *sqlx.DB, tables ...string) error {
+	if len(tables) == 0 {
+		return nil
+	}
+	order, err := insertOrder(tables)
+	if err != nil {
+		return err
+	}
+	d := torm.DialectOf(db)
+	quoted := make([]string, len(order))
+	for i, info := range order {
+		quoted[len(order)-1-i] = d.QuoteTable(info.Name)
+	}
+
+	switch d {
+	case torm.Postgres:
+		_, err := db.ExecContext(ctx, "TRUNCATE TABLE "+strings.Join(quoted, ", ")+" RESTART IDENTITY CASCADE")
+		return err
+	case torm.MySQL:
+		// TRUNCATE refuses tables that are referenced by a foreign key, so
+		// the checks are turned off on the connection doing it.
+		conn, err := db.Connx(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+			return err
+		}
+		for _, table := range quoted {
+			if _, err = conn.ExecContext(ctx, "TRUNCATE TABLE "+table); err != nil {
+				break
+			}
+		}
+		// the checks are turned back on even when ctx is done; should that
+		// fail, the connection is discarded rather than pooled without them.
+		if _, e := conn.ExecContext(context.WithoutCancel(ctx), "SET FOREIGN_KEY_CHECKS = 1"); e != nil {
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+			if err == nil {
+				err = e
+			}
+		}
+		return err
+	default:
+		for _, table := range quoted {
+			if _, err := db.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func contains(cols []string, col string) bool {
+	for _, c := range cols {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
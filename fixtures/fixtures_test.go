@@ -0,0 +1,187 @@
+package fixtures_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/pinnacles/torm"
+	"github.com/pinnacles/torm/fixtures"
+	"github.com/pinnacles/torm/tormtest"
+)
+
+type user struct {
+	ID       int     `db:"id" torm:"autoIncrement"`
+	Name     string  `db:"name"`
+	Nickname *string `db:"nickname"`
+}
+
+func (user) TableName() string { return "users" }
+
+type post struct {
+	ID          int       `db:"id" torm:"autoIncrement"`
+	AuthorID    int       `db:"author_id" torm:"references:users.id"`
+	Title       string    `db:"title"`
+	PublishedAt time.Time `db:"published_at"`
+}
+
+func (post) TableName() string { return "posts" }
+
+type comment struct {
+	ID       int    `db:"id" torm:"autoIncrement"`
+	PostID   int    `db:"post_id" torm:"references:posts"`
+	AuthorID int    `db:"author_id" torm:"references:users"`
+	Body     string `db:"body"`
+}
+
+func (comment) TableName() string { return "comments" }
+
+type account struct {
+	ID       int    `db:"id"`
+	TenantID int    `db:"tenant_id" torm:"tenant"`
+	Name     string `db:"name"`
+}
+
+func (account) TableName() string { return "accounts" }
+
+func init() {
+	torm.Register(account{})
+	torm.Register(user{})
+	torm.Register(post{})
+	torm.Register(comment{})
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	h := tormtest.NewHandler(t, torm.MySQL)
+	l := fixtures.New(h.DB,
+		fixtures.WithNow(func() time.Time { return now }),
+		fixtures.WithFuncs(template.FuncMap{"upper": strings.ToUpper}),
+	)
+	if err := l.Load(ctx, "testdata/blog.yml", "testdata/users.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	nickname := "b"
+	want := []tormtest.Statement{
+		{Query: "BEGIN", Args: []interface{}{}},
+		{Query: "INSERT INTO `users` (`id`,`name`,`nickname`) VALUES (?,?,?)", Args: []interface{}{1, "alice", (*string)(nil)}},
+		{Query: "INSERT INTO `users` (`id`,`name`,`nickname`) VALUES (?,?,?)", Args: []interface{}{2, "bob", &nickname}},
+		{Query: "INSERT INTO `posts` (`id`,`author_id`,`title`,`published_at`) VALUES (?,?,?,?)", Args: []interface{}{1, 1, "hello", now}},
+		{Query: "INSERT INTO `comments` (`id`,`post_id`,`author_id`,`body`) VALUES (?,?,?,?)", Args: []interface{}{1, 1, 2, "nice POST"}},
+		{Query: "COMMIT", Args: []interface{}{}},
+	}
+	if got := h.Statements(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got statements\n%+v\nwant\n%+v", got, want)
+	}
+
+	h.Reset()
+	if err := l.Truncate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var queries []string
+	for _, s := range h.Statements() {
+		queries = append(queries, s.Query)
+	}
+	wantQueries := []string{
+		"SET FOREIGN_KEY_CHECKS = 0",
+		"TRUNCATE TABLE `comments`",
+		"TRUNCATE TABLE `posts`",
+		"TRUNCATE TABLE `users`",
+		"SET FOREIGN_KEY_CHECKS = 1",
+	}
+	if !reflect.DeepEqual(queries, wantQueries) {
+		t.Errorf("got truncate statements %q, want %q", queries, wantQueries)
+	}
+}
+
+func TestTruncatePostgres(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.Postgres)
+	if err := fixtures.Truncate(context.Background(), h.DB, "users", "comments", "posts"); err != nil {
+		t.Fatal(err)
+	}
+	stmts := h.Statements()
+	if len(stmts) != 1 || stmts[0].Query != `TRUNCATE TABLE "comments", "posts", "users" RESTART IDENTITY CASCADE` {
+		t.Errorf("unexpected statements %+v", stmts)
+	}
+}
+
+func TestTruncateDiscardsConnection(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.MySQL)
+	boom := errors.New("boom")
+	h.OnError("FOREIGN_KEY_CHECKS = 1", boom)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := fixtures.Truncate(ctx, h.DB, "users"); !errors.Is(err, boom) {
+		t.Fatalf("got %v, want boom", err)
+	}
+	if n := h.DB.Stats().Idle; n != 0 {
+		t.Errorf("%d connections without foreign key checks went back to the pool", n)
+	}
+}
+
+func TestLoadRollback(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.MySQL)
+	h.OnError("INSERT INTO `posts`", errors.New("constraint"))
+	l := fixtures.New(h.DB, fixtures.WithFuncs(template.FuncMap{"upper": strings.ToUpper}))
+	if err := l.Load(context.Background(), "testdata/blog.yml", "testdata/users.json"); err == nil || !strings.Contains(err.Error(), "posts row 1: constraint") {
+		t.Fatalf("got %v", err)
+	}
+	stmts := h.Statements()
+	if last := stmts[len(stmts)-1].Query; last != "ROLLBACK" {
+		t.Errorf("last statement is %s, want ROLLBACK", last)
+	}
+	if err := l.Truncate(context.Background()); err != nil || len(h.Statements()) != len(stmts) {
+		t.Errorf("tables of a failed load were truncated: %v", err)
+	}
+}
+
+func TestLoadTenants(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.yml")
+	if err := os.WriteFile(path, []byte("accounts:\n  - id: 1\n    tenant_id: 1\n    name: a\n  - id: 2\n    tenant_id: 2\n    name: b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, ctx := range []context.Context{context.Background(), torm.WithTenant(context.Background(), 9)} {
+		h := tormtest.NewHandler(t, torm.MySQL)
+		if err := fixtures.New(h.DB).Load(ctx, path); err != nil {
+			t.Fatal(err)
+		}
+		var tenants []interface{}
+		for _, s := range h.Statements() {
+			if strings.HasPrefix(s.Query, "INSERT") {
+				tenants = append(tenants, s.Args[1])
+			}
+		}
+		if !reflect.DeepEqual(tenants, []interface{}{1, 2}) {
+			t.Errorf("got tenants %v, want [1 2]", tenants)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"unknown_table.yml":  "nope:\n  - id: 1\n",
+		"unknown_column.yml": "users:\n  - id: 1\n    age: 3\n",
+		"bad_type.yml":       "users:\n  - id: 1\n    name: 3\n",
+		"fraction.yml":       "users:\n  - id: 1.5\n",
+		"overflow.json":      `{"users": [{"id": 1e30}]}`,
+		"bad_ext.txt":        "users: []\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		h := tormtest.NewHandler(t, torm.MySQL)
+		if err := fixtures.New(h.DB).Load(context.Background(), path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -7,6 +7,7 @@ require (
 	github.com/hatajoe/ttools v0.0.11
 	github.com/jmoiron/sqlx v1.3.5
 	github.com/sirupsen/logrus v1.8.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,121 @@
+package torm
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMissingWhere = errors.New("torm: update or delete without a where clause, use All() to write the whole table")
+	ErrTautology    = errors.New("torm: update or delete with an always true where clause")
+)
+
+// WithTautologyGuard makes updates and deletes fail with ErrTautology when
+// their where clause is trivially true, like 1=1 or x OR TRUE.
+func WithTautologyGuard() Option {
+	return func(b *Builder) {
+		b.tautologyGuard = true
+	}
+}
+
+// guardWhere checks the where clause of an update or delete. all is set
+// when the caller asked for the whole table.
+func (t *Builder) guardWhere(clause string, all bool) error {
+	if all {
+		return nil
+	}
+	pred, _ := splitClause(clause)
+	if strings.TrimSpace(pred) == "" {
+		return ErrMissingWhere
+	}
+	if t.tautologyGuard && isTautology(pred) {
+		return ErrTautology
+	}
+	return nil
+}
+
+// isTautology reports whether pred is trivially true: TRUE, a non zero
+// number, two identical sides of =, or ORs and ANDs of those.
+func isTautology(pred string) bool {
+	pred = trimParens(pred)
+	if terms := splitTop(pred, "OR"); len(terms) > 1 {
+		for _, term := range terms {
+			if isTautology(term) {
+				return true
+			}
+		}
+		return false
+	}
+	if terms := splitTop(pred, "AND"); len(terms) > 1 {
+		for _, term := range terms {
+			if !isTautology(term) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if strings.EqualFold(pred, "TRUE") {
+		return true
+	}
+	if n, err := strconv.ParseFloat(pred, 64); err == nil {
+		return n != 0
+	}
+	if lhs, rhs, ok := strings.Cut(pred, "="); ok && !strings.ContainsAny(lhs, "<>!") && !strings.HasPrefix(rhs, "=") {
+		lhs, rhs = trimParens(lhs), trimParens(rhs)
+		return lhs != "" && lhs == rhs
+	}
+	return false
+}
+
+// trimParens trims spaces and the parentheses that enclose all of s.
+func trimParens(s string) string {
+	for {
+		s = strings.TrimSpace(s)
+		if len(s) < 2 || s[0] != '(' || s[len(s)-1] != ')' {
+			return s
+		}
+		if len(splitTop(s[1:len(s)-1], "")) != 1 {
+			return s
+		}
+		s = s[1 : len(s)-1]
+	}
+}
+
+// splitTop splits s at the keyword kw outside of quotes and parentheses.
+// With an empty kw it only checks that parentheses are balanced, returning
+// nil when they are not.
+func splitTop(s, kw string) []string {
+	var terms []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			continue
+		case c == '(':
+			depth++
+			continue
+		case c == ')':
+			if depth--; depth < 0 {
+				return nil
+			}
+			continue
+		}
+		if kw == "" || depth != 0 || (i > 0 && !isSpace(s[i-1])) || !hasKeyword(s[i:], kw) {
+			continue
+		}
+		terms = append(terms, s[start:i])
+		start = i + len(kw)
+		i = start - 1
+	}
+	return append(terms, s[start:])
+}
@@ -0,0 +1,78 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+func TestMissingWhere(t *testing.T) {
+	builder := NewBuilder(nil)
+	s := &test.TestSchema{Foo: 1}
+	for name, err := range map[string]error{
+		"update":       second(builder.Update("foo").Where("").ToSQL(s)),
+		"update limit": second(builder.Update("foo").Where(" LIMIT 1").ToSQL(s)),
+		"delete":       second(builder.Delete().Where("  ").ToSQL(s)),
+		"delete order": second(builder.Delete().Where("ORDER BY id LIMIT 1").ToSQL(s)),
+	} {
+		if !errors.Is(err, ErrMissingWhere) {
+			t.Errorf("%s: got %v, want ErrMissingWhere", name, err)
+		}
+	}
+}
+
+func TestWhereAll(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		tm := time.Now()
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `test` SET `foo`=?,`updated_at`=?")).
+			WithArgs(1, tm).
+			WillReturnResult(sqlmock.NewResult(0, 5))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test`")).
+			WillReturnResult(sqlmock.NewResult(0, 5))
+
+		builder := NewBuilder(db)
+		builder.SetTime(&tm)
+		if _, err := builder.Update("foo").All().Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := builder.Delete().All().Exec(ctx, &test.TestSchema{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTautologyGuard(t *testing.T) {
+	builder := NewBuilder(nil, WithTautologyGuard())
+	s := &test.TestSchema{Foo: 1}
+	for _, clause := range []string{"1=1", "1 = 1", "TRUE", "(1)", "foo = :foo OR 1=1", "'a' = 'a' AND 2", "((id = id))", "foo = :foo or true"} {
+		if _, err := builder.Delete().Where(clause).ToSQL(s); !errors.Is(err, ErrTautology) {
+			t.Errorf("Where(%q): got %v, want ErrTautology", clause, err)
+		}
+	}
+	for _, clause := range []string{"foo = :foo", "1=1 AND foo = :foo", "0", "foo >= foo", "foo != foo", "name = '1=1'", "(a = 1) OR (b = 2)"} {
+		if _, err := builder.Delete().Where(clause).ToSQL(s); err != nil {
+			t.Errorf("Where(%q): %v", clause, err)
+		}
+	}
+	if _, err := NewBuilder(nil).Update("foo").Where("1=1").ToSQL(s); err != nil {
+		t.Errorf("tautology rejected without the guard: %v", err)
+	}
+	if _, err := builder.Update("foo").All().ToSQL(s); err != nil {
+		t.Errorf("All rejected by the guard: %v", err)
+	}
+}
+
+func second(_ interface{}, err error) error {
+	return err
+}
@@ -0,0 +1,115 @@
+package torm
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// TableInfo describes a registered schema, for packages that build on
+// torm's metadata such as fixture loaders.
+type TableInfo struct {
+	Name string
+	// Type is the registered struct type.
+	Type    reflect.Type
+	Columns []string
+	// Fields holds the index path of the struct field of every column.
+	Fields        [][]int
+	AutoIncrement []string
+	// References maps the columns tagged references:table[.column] to
+	// the table they reference.
+	References map[string]string
+	// Tenant is the tenant column, empty for tables that have none.
+	Tenant string
+}
+
+// Lookup returns the registration of table.
+func Lookup(table string) (TableInfo, bool) {
+	m, ok := metas[table]
+	if !ok {
+		return TableInfo{}, false
+	}
+	info := TableInfo{
+		Name:          m.TableName,
+		Type:          m.typ,
+		Columns:       cloneFields(m.Fields),
+		Fields:        append([][]int(nil), m.fieldIndex...),
+		AutoIncrement: cloneFields(m.AutoIncrementColumns),
+		References:    make(map[string]string, len(m.references)),
+	}
+	for col, ref := range m.references {
+		table, _, _ := strings.Cut(ref, ".")
+		info.References[col] = table
+	}
+	if m.tenant != nil {
+		info.Tenant = m.tenant.column
+	}
+	return info, true
+}
+
+// ReferenceOrder sorts the registered tables so that the tables a table
+// references come before it, alphabetically otherwise. It fails for tables
+// that are not registered or reference each other.
+func ReferenceOrder(tables []string) ([]string, error) {
+	for _, table := range tables {
+		if _, ok := metas[table]; !ok {
+			return nil, fmt.Errorf("torm: table %s is not registered", table)
+		}
+	}
+	sorted := append([]string(nil), tables...)
+	sort.Strings(sorted)
+	wanted := make(map[string]bool, len(sorted))
+	for _, table := range sorted {
+		wanted[table] = true
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	order := make([]string, 0, len(sorted))
+	var visit func(table string, path []string) error
+	visit = func(table string, path []string) error {
+		switch state[table] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("torm: tables reference each other: %s", strings.Join(append(path, table), " -> "))
+		}
+		state[table] = visiting
+		var refs []string
+		for _, ref := range metas[table].references {
+			ref, _, _ = strings.Cut(ref, ".")
+			if wanted[ref] && ref != table {
+				refs = append(refs, ref)
+			}
+		}
+		sort.Strings(refs)
+		for _, ref := range refs {
+			if err := visit(ref, append(path, table)); err != nil {
+				return err
+			}
+		}
+		state[table] = done
+		order = append(order, table)
+		return nil
+	}
+	for _, table := range sorted {
+		if err := visit(table, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Tables returns the names of the registered tables in order.
+func Tables() []string {
+	names := make([]string, 0, len(metas))
+	for name := range metas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,138 @@
+package torm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"time"
+)
+
+type OpKind uint8
+
+const (
+	OpSelect OpKind = iota
+	OpInsert
+	OpUpdate
+	OpDelete
+)
+
+func (k OpKind) String() string {
+	switch k {
+	case OpSelect:
+		return "SELECT"
+	case OpInsert:
+		return "INSERT"
+	case OpUpdate:
+		return "UPDATE"
+	case OpDelete:
+		return "DELETE"
+	}
+	return "UNKNOWN"
+}
+
+// Op describes the statement a builder runs. Table is the registered table
+// name and Target the one the statement uses, which differs when the table
+// was overridden. Fields are the columns written or read and must not be
+// modified.
+type Op struct {
+	Kind   OpKind
+	Table  string
+	Target string
+	Fields []string
+}
+
+func newOp(kind OpKind, meta *tableMeta, table string, fields []string) Op {
+	if table == "" {
+		table = meta.TableName
+	}
+	return Op{Kind: kind, Table: meta.TableName, Target: table, Fields: fields}
+}
+
+// Result is the outcome of a statement. Exec is the result of an insert,
+// update or delete and nil for a select. Rows is the number of rows
+// affected or returned, -1 when it is unknown.
+type Result struct {
+	Exec sql.Result
+	Rows int64
+}
+
+// Invoker runs a statement.
+type Invoker func(ctx context.Context, op Op, sql *SQL) (Result, error)
+
+// Interceptor runs around every statement a builder runs and calls next to
+// run it, possibly with a different context or SQL.
+type Interceptor func(ctx context.Context, op Op, sql *SQL, next Invoker) (Result, error)
+
+// WithInterceptors adds interceptors to the builder. The first one given is
+// the outermost.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(b *Builder) {
+		b.interceptors = append(b.interceptors[:len(b.interceptors):len(b.interceptors)], interceptors...)
+	}
+}
+
+// invoke runs s through the interceptors of the builder, then runs it on h
+// with run. Statements are logged, and slow ones explained, once the
+// interceptors have returned, so that the time this takes is not counted
+// as the statement's. Entries the logger turns down are neither built nor
+// redacted.
+func (t *Builder) invoke(ctx context.Context, h handler, s *SQL, run Invoker) (Result, error) {
+	var pending []func()
+	defer func() {
+		for _, log := range pending {
+			log()
+		}
+	}()
+	outer := ctx
+	next := func(ctx context.Context, op Op, s *SQL) (Result, error) {
+		start := time.Now()
+		res, err := run(ctx, op, s)
+		e := LogEntry{Query: s.Query, Duration: time.Since(start), Rows: res.Rows, Err: err}
+		if !t.isSlow(e.Duration) && !t.logEnabled(ctx, e) {
+			return res, err
+		}
+		pending = append(pending, func() {
+			e.Slow = t.slowQuery(ctx, outer, h, op, s, e.Duration, err)
+			if !t.logEnabled(ctx, e) {
+				return
+			}
+			if e.Slow != nil {
+				e.Args = e.Slow.Args
+			} else {
+				e.Args = redactArgs(s)
+			}
+			t.logger().Log(ctx, e)
+		})
+		return res, err
+	}
+	for i := len(t.interceptors) - 1; i >= 0; i-- {
+		interceptor, n := t.interceptors[i], next
+		next = func(ctx context.Context, op Op, s *SQL) (Result, error) {
+			return interceptor(ctx, op, s, n)
+		}
+	}
+	return next(ctx, s.op, s)
+}
+
+func execResult(r sql.Result, err error) (Result, error) {
+	res := Result{Exec: r, Rows: -1}
+	if err == nil && r != nil {
+		if n, err := r.RowsAffected(); err == nil {
+			res.Rows = n
+		}
+	}
+	return res, err
+}
+
+func queryResult(dest interface{}, many bool, err error) (Result, error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Result{Rows: 0}, err
+	case err != nil:
+		return Result{Rows: -1}, err
+	case many:
+		return Result{Rows: int64(dereference(reflect.ValueOf(dest)).Len())}, nil
+	}
+	return Result{Rows: 1}, nil
+}
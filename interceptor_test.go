@@ -0,0 +1,94 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+func TestInterceptors(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		tm := time.Now()
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `test_202610` (`foo`,`created_at`,`updated_at`) VALUES (?,?,?) /* outer */")).
+			WithArgs(1, tm, tm).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `foo` FROM `test` WHERE foo = ? /* outer */")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"foo"}).AddRow(1).AddRow(1))
+
+		var calls []string
+		var ops []Op
+		var results []Result
+		outer := func(ctx context.Context, op Op, sql *SQL, next Invoker) (Result, error) {
+			calls = append(calls, "outer")
+			ops = append(ops, op)
+			s := *sql
+			s.Query += " /* outer */"
+			res, err := next(ctx, op, &s)
+			results = append(results, res)
+			return res, err
+		}
+		inner := func(ctx context.Context, op Op, sql *SQL, next Invoker) (Result, error) {
+			calls = append(calls, "inner")
+			return next(ctx, op, sql)
+		}
+
+		builder := NewBuilder(db, WithInterceptors(outer), WithInterceptors(inner))
+		builder.SetTime(&tm)
+		if _, err := builder.Insert("foo").Table("test_202610").Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+		rows := []test.TestSchema{}
+		if err := builder.Select("foo").Where("foo = :foo", KV{"foo": 1}).Query(ctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := []string{"outer", "inner", "outer", "inner"}; !reflect.DeepEqual(calls, want) {
+			t.Errorf("calls = %v, want %v", calls, want)
+		}
+		want := []Op{
+			{Kind: OpInsert, Table: "test", Target: "test_202610", Fields: []string{"foo", "created_at", "updated_at"}},
+			{Kind: OpSelect, Table: "test", Target: "test", Fields: []string{"foo"}},
+		}
+		if !reflect.DeepEqual(ops, want) {
+			t.Errorf("ops = %+v, want %+v", ops, want)
+		}
+		if results[0].Rows != 1 || results[0].Exec == nil || results[1].Rows != 2 {
+			t.Errorf("unexpected results %+v", results)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		denied := errors.New("denied")
+		guard := func(ctx context.Context, op Op, sql *SQL, next Invoker) (Result, error) {
+			if op.Kind == OpDelete && op.Table == "test" {
+				return Result{Rows: -1}, denied
+			}
+			return next(ctx, op, sql)
+		}
+
+		builder := NewBuilder(db, WithInterceptors(guard))
+		if _, err := builder.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1}); !errors.Is(err, denied) {
+			t.Errorf("got %v, want denied", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,33 @@
+// Package conv holds the value conversions torm and its subpackages share.
+package conv
+
+import "reflect"
+
+// IsNumber reports whether k is an integer or floating point kind.
+func IsNumber(k reflect.Kind) bool {
+	return reflect.Int <= k && k <= reflect.Float64 && k != reflect.Uintptr
+}
+
+// Number converts the number v to the number type t. It fails when the
+// value doesn't survive the conversion, like 1.5 to an int, 300 to an
+// uint8 or -1 to an uint.
+func Number(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	if !IsNumber(v.Kind()) || !IsNumber(t.Kind()) {
+		return reflect.Value{}, false
+	}
+	c := v.Convert(t)
+	if c.Convert(v.Type()).Interface() != v.Interface() || negative(c) != negative(v) {
+		return reflect.Value{}, false
+	}
+	return c, true
+}
+
+func negative(v reflect.Value) bool {
+	switch {
+	case reflect.Int <= v.Kind() && v.Kind() <= reflect.Int64:
+		return v.Int() < 0
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		return v.Float() < 0
+	}
+	return false
+}
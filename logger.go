@@ -0,0 +1,176 @@
+package torm
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogEntry describes a statement run by a builder.
+type LogEntry struct {
+	Query    string
+	Args     []interface{}
+	Duration time.Duration
+	// Rows is the number of rows affected by an exec or returned by a
+	// query, or -1 when it is unknown.
+	Rows int64
+	Err  error
+	// Slow is set when the statement took longer than the threshold of
+	// WithSlowQueryLog.
+	Slow *SlowQuery
+}
+
+// Logger receives an entry for every statement a builder runs.
+type Logger interface {
+	Log(ctx context.Context, e LogEntry)
+}
+
+// EnabledLogger is a Logger that tells whether it would write an entry.
+// Builders ask it before they redact the arguments of a statement, with an
+// entry whose Args are not set yet, and skip the entries it turns down.
+type EnabledLogger interface {
+	Logger
+	Enabled(ctx context.Context, e LogEntry) bool
+}
+
+// WithLogger makes the builder log its statements to l instead of the
+// package logger that VerboseLevel controls.
+func WithLogger(l Logger) Option {
+	return func(b *Builder) {
+		b.log = l
+	}
+}
+
+// std is the logger of builders without WithLogger. It is private so that
+// importing torm leaves the application's logrus setup alone. It logs
+// failed statements at Info level like any other, so that they stay hidden
+// at its default Warn level as they always have.
+var std = func() *logrus.Logger {
+	l := logrus.New()
+	l.SetOutput(os.Stdout)
+	l.SetLevel(logrus.WarnLevel)
+	return l
+}()
+
+// SlogLogger logs statements to l, at Info level or at Error level when
+// they fail.
+func SlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (l slogLogger) Enabled(ctx context.Context, e LogEntry) bool {
+	return l.l.Enabled(ctx, slogLevel(e))
+}
+
+func slogLevel(e LogEntry) slog.Level {
+	switch {
+	case e.Err != nil:
+		return slog.LevelError
+	case e.Slow != nil:
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+func (l slogLogger) Log(ctx context.Context, e LogEntry) {
+	attrs := []slog.Attr{
+		slog.String("sql", e.Query),
+		slog.Any("args", e.Args),
+		slog.Duration("duration", e.Duration),
+		slog.Int64("rows", e.Rows),
+	}
+	if e.Err != nil {
+		l.l.LogAttrs(ctx, slog.LevelError, "torm: statement failed", append(attrs, slog.Any("error", e.Err))...)
+		return
+	}
+	if q := e.Slow; q != nil {
+		attrs = append(attrs,
+			slog.Duration("threshold", q.Threshold),
+			slog.Bool("full_scan", q.FullScan),
+			slog.Bool("filesort", q.Filesort),
+		)
+		if q.Plan != nil {
+			attrs = append(attrs, slog.Any("plan", q.Plan))
+		}
+		l.l.LogAttrs(ctx, slog.LevelWarn, "torm: slow statement", attrs...)
+		return
+	}
+	l.l.LogAttrs(ctx, slog.LevelInfo, "torm: statement", attrs...)
+}
+
+// LogrusLogger logs statements to l, at Info level or at Error level when
+// they fail.
+func LogrusLogger(l logrus.FieldLogger) Logger {
+	return logrusLogger{l: l, failLevel: logrus.ErrorLevel}
+}
+
+type logrusLogger struct {
+	l         logrus.FieldLogger
+	failLevel logrus.Level
+}
+
+// Enabled asks the logrus logger behind l, when there is one to ask.
+func (l logrusLogger) Enabled(ctx context.Context, e LogEntry) bool {
+	level := logrus.InfoLevel
+	switch {
+	case e.Err != nil:
+		level = l.failLevel
+	case e.Slow != nil:
+		level = logrus.WarnLevel
+	}
+	switch v := l.l.(type) {
+	case *logrus.Logger:
+		return v.IsLevelEnabled(level)
+	case *logrus.Entry:
+		return v.Logger.IsLevelEnabled(level)
+	}
+	return true
+}
+
+func (l logrusLogger) Log(ctx context.Context, e LogEntry) {
+	entry := l.l.WithFields(logrus.Fields{
+		"sql":      e.Query,
+		"args":     e.Args,
+		"duration": e.Duration,
+		"rows":     e.Rows,
+	})
+	if e.Err != nil {
+		entry.WithError(e.Err).Log(l.failLevel, "torm: statement failed")
+		return
+	}
+	if q := e.Slow; q != nil {
+		entry = entry.WithFields(logrus.Fields{
+			"threshold": q.Threshold,
+			"full_scan": q.FullScan,
+			"filesort":  q.Filesort,
+		})
+		if q.Plan != nil {
+			entry = entry.WithField("plan", q.Plan)
+		}
+		entry.Warn("torm: slow statement")
+		return
+	}
+	entry.Info("torm: statement")
+}
+
+// logEnabled reports whether the logger of the builder would write e.
+func (t *Builder) logEnabled(ctx context.Context, e LogEntry) bool {
+	if l, ok := t.logger().(EnabledLogger); ok {
+		return l.Enabled(ctx, e)
+	}
+	return true
+}
+
+func (t *Builder) logger() Logger {
+	if t.log != nil {
+		return t.log
+	}
+	return logrusLogger{l: std, failLevel: logrus.InfoLevel}
+}
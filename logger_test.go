@@ -0,0 +1,198 @@
+package torm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+	"github.com/sirupsen/logrus"
+)
+
+type recordLogger struct {
+	entries []LogEntry
+}
+
+func (l *recordLogger) Log(ctx context.Context, e LogEntry) {
+	l.entries = append(l.entries, e)
+}
+
+func TestLoggerEntries(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `foo` FROM `test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"foo"}).AddRow(1).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `foo` FROM `test` WHERE foo = ?")).
+			WithArgs(2).
+			WillReturnError(errors.New("boom"))
+
+		l := &recordLogger{}
+		builder := NewBuilder(db, WithLogger(l))
+		if _, err := builder.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+		rows := []test.TestSchema{}
+		if err := builder.Select("foo").Where("foo = :foo", KV{"foo": 1}).Query(ctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.Select("foo").Where("foo = :foo", KV{"foo": 2}).Query(ctx, &rows); err == nil {
+			t.Fatal("expected an error")
+		}
+
+		if len(l.entries) != 3 {
+			t.Fatalf("got %d entries, want 3", len(l.entries))
+		}
+		if e := l.entries[0]; e.Query != "DELETE FROM `test` WHERE foo = ?" || e.Rows != 3 || e.Err != nil || len(e.Args) != 1 {
+			t.Errorf("unexpected delete entry %+v", e)
+		}
+		if e := l.entries[1]; e.Rows != 2 || e.Err != nil {
+			t.Errorf("unexpected select entry %+v", e)
+		}
+		if e := l.entries[2]; e.Rows != -1 || e.Err == nil {
+			t.Errorf("unexpected failed select entry %+v", e)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoggerAdapters(t *testing.T) {
+	e := LogEntry{Query: "SELECT 1", Args: []interface{}{1}, Rows: 1, Err: errors.New("boom")}
+
+	var sb bytes.Buffer
+	SlogLogger(slog.New(slog.NewJSONHandler(&sb, nil))).Log(context.Background(), e)
+
+	var lb bytes.Buffer
+	ll := logrus.New()
+	ll.SetOutput(&lb)
+	ll.SetFormatter(&logrus.JSONFormatter{})
+	LogrusLogger(ll).Log(context.Background(), e)
+
+	for name, b := range map[string]*bytes.Buffer{"slog": &sb, "logrus": &lb} {
+		rec := map[string]interface{}{}
+		if err := json.Unmarshal(b.Bytes(), &rec); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if rec["sql"] != "SELECT 1" || rec["rows"] != float64(1) || rec["error"] != "boom" {
+			t.Errorf("%s: unexpected record %v", name, rec)
+		}
+		if _, ok := rec["duration"]; !ok {
+			t.Errorf("%s: missing duration in %v", name, rec)
+		}
+	}
+}
+
+func TestNoGlobalLogrusSetup(t *testing.T) {
+	level := logrus.GetLevel()
+	VerboseLevel(3)
+	defer VerboseLevel(0)
+	if logrus.GetLevel() != level {
+		t.Errorf("VerboseLevel changed the global logrus level to %s", logrus.GetLevel())
+	}
+	if logrus.GetLevel() != logrus.InfoLevel {
+		t.Errorf("global logrus level is %s, want the default info", logrus.GetLevel())
+	}
+}
+
+func TestDefaultLoggerHidesFailures(t *testing.T) {
+	var b bytes.Buffer
+	level := std.GetLevel()
+	std.SetOutput(&b)
+	std.SetLevel(logrus.WarnLevel)
+	defer func() {
+		std.SetOutput(os.Stdout)
+		std.SetLevel(level)
+	}()
+
+	NewBuilder(nil).logger().Log(context.Background(), LogEntry{Query: "SELECT 1", Err: errors.New("boom")})
+	if b.Len() != 0 {
+		t.Errorf("failed statement was logged at the default level: %s", b.String())
+	}
+	std.SetLevel(logrus.InfoLevel)
+	NewBuilder(nil).logger().Log(context.Background(), LogEntry{Query: "SELECT 1", Err: errors.New("boom")})
+	if !strings.Contains(b.String(), "boom") {
+		t.Errorf("failed statement wasn't logged at info level: %s", b.String())
+	}
+}
+
+type levelLogger struct {
+	recordLogger
+	asked []LogEntry
+}
+
+func (l *levelLogger) Enabled(ctx context.Context, e LogEntry) bool {
+	l.asked = append(l.asked, e)
+	return e.Err != nil
+}
+
+func TestLoggerEnabled(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ?")).
+			WithArgs(2).
+			WillReturnError(errors.New("boom"))
+
+		l := &levelLogger{}
+		builder := NewBuilder(db, WithLogger(l))
+		if _, err := builder.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := builder.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 2}); err == nil {
+			t.Fatal("expected an error")
+		}
+
+		for _, e := range l.asked {
+			if e.Args != nil {
+				t.Errorf("Enabled got redacted args %v", e.Args)
+			}
+		}
+		if len(l.entries) != 1 || l.entries[0].Err == nil || len(l.entries[0].Args) != 1 {
+			t.Errorf("unexpected entries %+v", l.entries)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoggerAdaptersEnabled(t *testing.T) {
+	ctx := context.Background()
+	ok := LogEntry{Query: "SELECT 1"}
+	failed := LogEntry{Query: "SELECT 1", Err: errors.New("boom")}
+
+	sl := SlogLogger(slog.New(slog.NewJSONHandler(&bytes.Buffer{}, &slog.HandlerOptions{Level: slog.LevelWarn}))).(EnabledLogger)
+	if sl.Enabled(ctx, ok) || !sl.Enabled(ctx, failed) {
+		t.Error("slog logger at warn level should only take failed statements")
+	}
+
+	ll := logrus.New()
+	ll.SetLevel(logrus.WarnLevel)
+	for name, l := range map[string]Logger{"logger": LogrusLogger(ll), "entry": LogrusLogger(ll.WithField("app", "test"))} {
+		el := l.(EnabledLogger)
+		if el.Enabled(ctx, ok) || !el.Enabled(ctx, failed) {
+			t.Errorf("%s: logrus logger at warn level should only take failed statements", name)
+		}
+	}
+
+	if NewBuilder(nil).logEnabled(ctx, failed) != std.IsLevelEnabled(logrus.InfoLevel) {
+		t.Error("default logger should take failed statements at info level")
+	}
+}
@@ -0,0 +1,185 @@
+package torm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsRecorder is told about every statement a builder runs.
+type MetricsRecorder interface {
+	Observe(op Op, d time.Duration, rows int64, err error)
+}
+
+// WithMetrics reports every statement the builder runs to m. Statements are
+// timed where the option appears among WithInterceptors options.
+func WithMetrics(m MetricsRecorder) Option {
+	return WithInterceptors(func(ctx context.Context, op Op, sql *SQL, next Invoker) (Result, error) {
+		start := time.Now()
+		res, err := next(ctx, op, sql)
+		m.Observe(op, time.Since(start), res.Rows, err)
+		return res, err
+	})
+}
+
+// DefaultBuckets are the latency buckets of NewMetrics, in seconds.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics keeps latency histograms, call, error and row counts in memory,
+// labelled by registered table and operation. It serves them in the
+// Prometheus text format.
+type Metrics struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[metricKey]*metricSeries
+}
+
+type metricKey struct {
+	table string
+	op    OpKind
+}
+
+type metricSeries struct {
+	count   uint64
+	errors  uint64
+	rows    int64
+	sum     time.Duration
+	buckets []uint64
+}
+
+// NewMetrics creates a Metrics with the given upper bounds in seconds, or
+// DefaultBuckets when none are given.
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{buckets: buckets, series: map[metricKey]*metricSeries{}}
+}
+
+func (m *Metrics) Observe(op Op, d time.Duration, rows int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := metricKey{table: op.Table, op: op.Kind}
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricSeries{buckets: make([]uint64, len(m.buckets))}
+		m.series[key] = s
+	}
+	s.count++
+	if err != nil {
+		s.errors++
+	}
+	if rows > 0 {
+		s.rows += rows
+	}
+	s.sum += d
+	for i, le := range m.buckets {
+		if d.Seconds() <= le {
+			s.buckets[i]++
+		}
+	}
+}
+
+// MetricSnapshot holds the metrics of one table and operation. Buckets are
+// cumulative, like Prometheus histogram buckets.
+type MetricSnapshot struct {
+	Table   string
+	Op      OpKind
+	Count   uint64
+	Errors  uint64
+	Rows    int64
+	Sum     time.Duration
+	Buckets []Bucket
+}
+
+type Bucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+// Snapshot returns the current metrics ordered by table and operation.
+func (m *Metrics) Snapshot() []MetricSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap := make([]MetricSnapshot, 0, len(m.series))
+	for key, s := range m.series {
+		ms := MetricSnapshot{
+			Table:   key.table,
+			Op:      key.op,
+			Count:   s.count,
+			Errors:  s.errors,
+			Rows:    s.rows,
+			Sum:     s.sum,
+			Buckets: make([]Bucket, len(m.buckets)),
+		}
+		for i, le := range m.buckets {
+			ms.Buckets[i] = Bucket{UpperBound: le, Count: s.buckets[i]}
+		}
+		snap = append(snap, ms)
+	}
+	sort.Slice(snap, func(i, j int) bool {
+		if snap[i].Table != snap[j].Table {
+			return snap[i].Table < snap[j].Table
+		}
+		return snap[i].Op < snap[j].Op
+	})
+	return snap
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition
+// format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	snap := m.Snapshot()
+	var b strings.Builder
+
+	b.WriteString("# HELP torm_query_duration_seconds Latency of the statements run by torm builders.\n")
+	b.WriteString("# TYPE torm_query_duration_seconds histogram\n")
+	for _, s := range snap {
+		labels := metricLabels(s)
+		for _, bucket := range s.Buckets {
+			fmt.Fprintf(&b, "torm_query_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(bucket.UpperBound, 'g', -1, 64), bucket.Count)
+		}
+		fmt.Fprintf(&b, "torm_query_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, s.Count)
+		fmt.Fprintf(&b, "torm_query_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(s.Sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(&b, "torm_query_duration_seconds_count{%s} %d\n", labels, s.Count)
+	}
+
+	counters := []struct {
+		name, help string
+		value      func(MetricSnapshot) int64
+	}{
+		{"torm_queries_total", "Statements run by torm builders.", func(s MetricSnapshot) int64 { return int64(s.Count) }},
+		{"torm_query_errors_total", "Statements run by torm builders that failed.", func(s MetricSnapshot) int64 { return int64(s.Errors) }},
+		{"torm_query_rows_total", "Rows returned or affected by statements run by torm builders.", func(s MetricSnapshot) int64 { return s.Rows }},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		for _, s := range snap {
+			fmt.Fprintf(&b, "%s{%s} %d\n", c.name, metricLabels(s), c.value(s))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP serves the metrics to a Prometheus scraper.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.WritePrometheus(w)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func metricLabels(s MetricSnapshot) string {
+	return `table="` + labelEscaper.Replace(s.Table) + `",operation="` + strings.ToLower(s.Op.String()) + `"`
+}
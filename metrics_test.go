@@ -0,0 +1,87 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+func TestMetrics(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `foo` FROM `test`")).
+			WillReturnRows(sqlmock.NewRows([]string{"foo"}).AddRow(1).AddRow(2))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `foo` FROM `test_202610`")).
+			WillReturnError(errors.New("boom"))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+
+		m := NewMetrics(0.5, 60)
+		builder := NewBuilder(db, WithMetrics(m))
+		rows := []test.TestSchema{}
+		if err := builder.Select("foo").Query(ctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.Select("foo").Table("test_202610").Query(ctx, &rows); err == nil {
+			t.Fatal("expected an error")
+		}
+		if _, err := builder.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+
+		snap := m.Snapshot()
+		if len(snap) != 2 {
+			t.Fatalf("got %d series, want 2", len(snap))
+		}
+		sel, del := snap[0], snap[1]
+		if sel.Table != "test" || sel.Op != OpSelect || sel.Count != 2 || sel.Errors != 1 || sel.Rows != 2 {
+			t.Errorf("unexpected select series %+v", sel)
+		}
+		if del.Op != OpDelete || del.Count != 1 || del.Errors != 0 || del.Rows != 3 {
+			t.Errorf("unexpected delete series %+v", del)
+		}
+		if b := sel.Buckets[1]; b.UpperBound != 60 || b.Count != 2 {
+			t.Errorf("unexpected bucket %+v", b)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMetricsPrometheus(t *testing.T) {
+	m := NewMetrics(1)
+	m.Observe(Op{Kind: OpUpdate, Table: `we"ird`}, 2*time.Second, 4, nil)
+	m.Observe(Op{Kind: OpUpdate, Table: `we"ird`}, 0, 0, errors.New("boom"))
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE torm_query_duration_seconds histogram",
+		`torm_query_duration_seconds_bucket{table="we\"ird",operation="update",le="1"} 1`,
+		`torm_query_duration_seconds_bucket{table="we\"ird",operation="update",le="+Inf"} 2`,
+		`torm_query_duration_seconds_sum{table="we\"ird",operation="update"} 2`,
+		`torm_query_duration_seconds_count{table="we\"ird",operation="update"} 2`,
+		`torm_queries_total{table="we\"ird",operation="update"} 2`,
+		`torm_query_errors_total{table="we\"ird",operation="update"} 1`,
+		`torm_query_rows_total{table="we\"ird",operation="update"} 4`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, body)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+}
@@ -0,0 +1,152 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm"
+)
+
+var (
+	// ErrLocked is returned when another migrator holds the lock for longer
+	// than the lock timeout.
+	ErrLocked = errors.New("migrate: migrations are locked by another process")
+	// ErrSingleConn is returned by databases that hold the lock on a
+	// connection of its own when the pool allows a single connection, as
+	// the migrations would then wait for the lock's connection forever.
+	ErrSingleConn = errors.New("migrate: the lock needs a connection of its own, allow at least two open connections")
+)
+
+// lockPoll is how often a lock that the database does not wait for is
+// tried again.
+var lockPoll = 500 * time.Millisecond
+
+// locker is the connection, or the database, a lock is taken on.
+type locker interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row
+}
+
+// lock takes the migration lock of the table and returns the function that
+// releases it. MySQL, Postgres and SQL Server use session locks, held on a
+// connection of their own, which the database drops with the connection.
+// SQLite has none, so a row of <table>_lock is inserted instead; should a
+// migrator die while holding it, ErrLocked is returned until the row is
+// deleted by hand with DELETE FROM <table>_lock.
+func (m *Migrator) lock(ctx context.Context) (func() error, error) {
+	d := torm.DialectOf(m.db)
+	name := "torm_migrate:" + m.table
+
+	var conn locker = m.db
+	closeConn := func() error { return nil }
+	if d != torm.SQLite {
+		if m.db.Stats().MaxOpenConnections == 1 {
+			return nil, ErrSingleConn
+		}
+		c, err := m.db.Connx(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conn, closeConn = c, c.Close
+	}
+
+	var try func() (bool, error)
+	var unlock func(ctx context.Context) error
+	locked := ErrLocked
+	switch d {
+	case torm.Postgres:
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		key := int64(h.Sum64())
+		try = func() (bool, error) {
+			var ok bool
+			err := conn.QueryRowxContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok)
+			return ok, err
+		}
+		unlock = func(ctx context.Context) error {
+			_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key)
+			return err
+		}
+	case torm.SQLServer:
+		try = func() (bool, error) {
+			var r int64
+			err := conn.QueryRowxContext(ctx, "DECLARE @r int; EXEC @r = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = @p2; SELECT @r", name, m.lockTimeout.Milliseconds()).Scan(&r)
+			return r >= 0, err
+		}
+		unlock = func(ctx context.Context) error {
+			_, err := conn.ExecContext(ctx, "EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'", name)
+			return err
+		}
+	case torm.SQLite:
+		table := d.QuoteTable(m.table + "_lock")
+		if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+table+" (id INTEGER PRIMARY KEY)"); err != nil {
+			return nil, err
+		}
+		try = func() (bool, error) {
+			res, err := conn.ExecContext(ctx, "INSERT OR IGNORE INTO "+table+" (id) VALUES (1)")
+			if err != nil {
+				return false, err
+			}
+			n, err := res.RowsAffected()
+			return n == 1, err
+		}
+		unlock = func(ctx context.Context) error {
+			_, err := conn.ExecContext(ctx, "DELETE FROM "+table+" WHERE id = 1")
+			return err
+		}
+		locked = fmt.Errorf("%w (if no migrator is running, a dead one left the lock: DELETE FROM %s)", ErrLocked, table)
+	default:
+		// GET_LOCK waits whole seconds; a shorter timeout is rounded up
+		// rather than down to 0, which would not wait at all.
+		timeout := int64(math.Ceil(m.lockTimeout.Seconds()))
+		try = func() (bool, error) {
+			var r *int64
+			err := conn.QueryRowxContext(ctx, "SELECT GET_LOCK(?, ?)", name, timeout).Scan(&r)
+			return r != nil && *r == 1, err
+		}
+		unlock = func(ctx context.Context) error {
+			_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", name)
+			return err
+		}
+	}
+
+	// MySQL and SQL Server wait for the lock on the server; the others are
+	// tried until the timeout.
+	waits := d != torm.Postgres && d != torm.SQLite
+	deadline := time.Now().Add(m.lockTimeout)
+	for {
+		ok, err := try()
+		if err != nil {
+			closeConn()
+			return nil, err
+		}
+		if ok {
+			return release(ctx, closeConn, unlock), nil
+		}
+		if waits || time.Now().After(deadline) {
+			closeConn()
+			return nil, locked
+		}
+		select {
+		case <-ctx.Done():
+			closeConn()
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+}
+
+// release unlocks even when ctx is done by then, so that the lock does not
+// outlive a cancelled migration on a pooled connection.
+func release(ctx context.Context, closeConn func() error, unlock func(context.Context) error) func() error {
+	return func() error {
+		defer closeConn()
+		return unlock(context.WithoutCancel(ctx))
+	}
+}
@@ -0,0 +1,453 @@
+// Package migrate applies versioned schema migrations that ship with an
+// application. Migrations are Go functions or SQL files; each one runs in a
+// torm transaction that also records it in the schema_migrations table,
+// together with a checksum that later runs compare against. A database lock
+// keeps concurrent deploys from migrating at the same time.
+//
+// MySQL commits implicitly before and after most DDL statements, so there
+// a migration that fails after a CREATE or ALTER keeps the statements run
+// so far and is not recorded. Give such migrations a single DDL statement,
+// or make them safe to run again.
+//
+//	//go:embed migrations
+//	var files embed.FS
+//
+//	ms, err := migrate.LoadFS(files, "migrations")
+//	...
+//	err = migrate.New(db, ms).Up(ctx)
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm"
+)
+
+// DefaultTable is the table applied migrations are recorded in.
+const DefaultTable = "schema_migrations"
+
+var (
+	ErrNoApplied        = errors.New("migrate: no migration has been applied")
+	ErrIrreversible     = errors.New("migrate: migration has no down direction")
+	ErrUnknownVersion   = errors.New("migrate: applied version has no migration")
+	ErrChecksumMismatch = errors.New("migrate: applied migration has changed")
+)
+
+// Func is one direction of a migration. It runs inside the transaction of
+// the migration, which ctx carries as well, so torm builders over the
+// migrated database join it.
+type Func func(ctx context.Context, tx *sqlx.Tx) error
+
+// Migration is a schema change identified by its version. Migrations are
+// applied in ascending version order and reverted in descending order.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      Func
+	Down    Func
+	// Checksum is recorded when the migration is applied and compared on
+	// every later run. SQL migrations get the SHA-256 of their statements;
+	// Go migrations have none unless it is set.
+	Checksum string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+// SQLMigration creates a migration that runs the statements of up and
+// down, which are separated by semicolons. An empty down makes the
+// migration irreversible.
+func SQLMigration(version int64, name, up, down string) Migration {
+	m := Migration{
+		Version:  version,
+		Name:     name,
+		Up:       execFunc(up),
+		Checksum: checksum(up, down),
+	}
+	if down != "" {
+		m.Down = execFunc(down)
+	}
+	return m
+}
+
+func execFunc(script string) Func {
+	return func(ctx context.Context, tx *sqlx.Tx) error {
+		for _, stmt := range splitStatements(script, torm.DialectOf(tx)) {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func checksum(up, down string) string {
+	sum := sha256.Sum256([]byte(up + "\x00" + down))
+	return hex.EncodeToString(sum[:])
+}
+
+// record is a row of the migrations table. It is not registered with
+// torm, so that the table doesn't show up in the application's schema.
+type record struct {
+	Version   int64     `db:"version"`
+	Name      string    `db:"name"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// Migrator applies a set of migrations to a database.
+type Migrator struct {
+	db          *sqlx.DB
+	b           *torm.Builder
+	migrations  []Migration
+	table       string
+	lockTimeout time.Duration
+	now         func() time.Time
+
+	builderOpts []torm.Option
+}
+
+type Option func(*Migrator)
+
+// WithTable records applied migrations in name instead of DefaultTable.
+func WithTable(name string) Option {
+	return func(m *Migrator) {
+		m.table = name
+	}
+}
+
+// WithLockTimeout sets how long to wait for another migrator to release
+// the lock, a minute by default.
+func WithLockTimeout(d time.Duration) Option {
+	return func(m *Migrator) {
+		m.lockTimeout = d
+	}
+}
+
+// WithNow sets the clock applied_at is taken from, time.Now by default.
+func WithNow(now func() time.Time) Option {
+	return func(m *Migrator) {
+		m.now = now
+	}
+}
+
+// WithBuilderOptions configures the builder migrations run on, for example
+// to log or trace them.
+func WithBuilderOptions(opts ...torm.Option) Option {
+	return func(m *Migrator) {
+		m.builderOpts = append(m.builderOpts, opts...)
+	}
+}
+
+// New creates a Migrator for migrations, which may be given in any order
+// but must not share versions.
+func New(db *sqlx.DB, migrations []Migration, opts ...Option) (*Migrator, error) {
+	m := &Migrator{
+		db:          db,
+		migrations:  append([]Migration(nil), migrations...),
+		table:       DefaultTable,
+		lockTimeout: time.Minute,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.b = torm.NewBuilder(db, m.builderOpts...)
+
+	sort.SliceStable(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+	for i, mig := range m.migrations {
+		if mig.Up == nil {
+			return nil, fmt.Errorf("migrate: %s has no up direction", mig)
+		}
+		if i > 0 && m.migrations[i-1].Version == mig.Version {
+			return nil, fmt.Errorf("migrate: %s and %s share a version", m.migrations[i-1], mig)
+		}
+	}
+	return m, nil
+}
+
+// Status is the state of a migration in the database.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Modified reports an applied migration whose checksum is not the one
+	// recorded when it was applied.
+	Modified bool
+	// Missing reports an applied version that there is no migration for.
+	Missing bool
+}
+
+// Status returns the state of every migration and of every applied version,
+// in version order.
+// It only reads: it neither takes the lock nor creates the migrations
+// table, which is taken as empty until it exists.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	exists, err := m.tableExists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return m.status(nil), nil
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.status(applied), nil
+}
+
+func (m *Migrator) status(applied map[int64]record) []Status {
+	var statuses []Status
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if r, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = r.AppliedAt
+			s.Modified = r.Checksum != mig.Checksum
+		}
+		statuses = append(statuses, s)
+	}
+	for _, r := range applied {
+		if _, ok := m.find(r.Version); !ok {
+			statuses = append(statuses, Status{Version: r.Version, Name: r.Name, Applied: true, AppliedAt: r.AppliedAt, Missing: true})
+		}
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.UpTo(ctx, -1)
+}
+
+// UpTo applies the pending migrations up to and including version, or all
+// of them when version is negative. It refuses to run when an applied
+// migration has changed since it was applied.
+func (m *Migrator) UpTo(ctx context.Context, version int64) error {
+	return m.locked(ctx, func(ctx context.Context, applied map[int64]record) error {
+		for _, s := range m.status(applied) {
+			if s.Modified {
+				return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, s.Version, s.Name)
+			}
+		}
+		for _, mig := range m.migrations {
+			if version >= 0 && mig.Version > version {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.up(ctx, mig); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.locked(ctx, func(ctx context.Context, applied map[int64]record) error {
+		mig, err := m.last(applied)
+		if err != nil {
+			return err
+		}
+		return m.down(ctx, mig)
+	})
+}
+
+// Redo reverts the last applied migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) error {
+	return m.locked(ctx, func(ctx context.Context, applied map[int64]record) error {
+		mig, err := m.last(applied)
+		if err != nil {
+			return err
+		}
+		if err := m.down(ctx, mig); err != nil {
+			return err
+		}
+		return m.up(ctx, mig)
+	})
+}
+
+func (m *Migrator) last(applied map[int64]record) (Migration, error) {
+	if len(applied) == 0 {
+		return Migration{}, ErrNoApplied
+	}
+	var last int64
+	for v := range applied {
+		if v > last {
+			last = v
+		}
+	}
+	mig, ok := m.find(last)
+	if !ok {
+		return Migration{}, fmt.Errorf("%w: %d", ErrUnknownVersion, last)
+	}
+	if mig.Down == nil {
+		return Migration{}, fmt.Errorf("%w: %s", ErrIrreversible, mig)
+	}
+	return mig, nil
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	i := sort.Search(len(m.migrations), func(i int) bool {
+		return m.migrations[i].Version >= version
+	})
+	if i < len(m.migrations) && m.migrations[i].Version == version {
+		return m.migrations[i], true
+	}
+	return Migration{}, false
+}
+
+func (m *Migrator) up(ctx context.Context, mig Migration) error {
+	err := m.b.Transaction(ctx, nil, func(ctx context.Context, _ *torm.Builder) error {
+		tx, _ := torm.TxFromContext(ctx)
+		if err := mig.Up(ctx, tx); err != nil {
+			return err
+		}
+		d := torm.DialectOf(m.db)
+		query := "INSERT INTO " + d.QuoteTable(m.table) + " (" + quoteColumns(d) + ") VALUES (?,?,?,?)"
+		_, err := tx.ExecContext(ctx, tx.Rebind(query), mig.Version, mig.Name, mig.Checksum, m.now().UTC())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("migrate: up %s: %w", mig, err)
+	}
+	return nil
+}
+
+func (m *Migrator) down(ctx context.Context, mig Migration) error {
+	err := m.b.Transaction(ctx, nil, func(ctx context.Context, _ *torm.Builder) error {
+		tx, _ := torm.TxFromContext(ctx)
+		if err := mig.Down(ctx, tx); err != nil {
+			return err
+		}
+		query := "DELETE FROM " + torm.DialectOf(m.db).QuoteTable(m.table) + " WHERE version = ?"
+		_, err := tx.ExecContext(ctx, tx.Rebind(query), mig.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("migrate: down %s: %w", mig, err)
+	}
+	return nil
+}
+
+// locked runs fn while holding the migration lock, with the versions that
+// are applied once it is held. The migrations table is created under the
+// lock as well.
+func (m *Migrator) locked(ctx context.Context, fn func(context.Context, map[int64]record) error) (err error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := unlock(); err == nil {
+			err = uerr
+		}
+	}()
+
+	if err := m.createTable(ctx); err != nil {
+		return err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(ctx, applied)
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]record, error) {
+	d := torm.DialectOf(m.db)
+	records := []record{}
+	if err := m.db.SelectContext(ctx, &records, "SELECT "+quoteColumns(d)+" FROM "+d.QuoteTable(m.table)); err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]record, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// columns are the columns of the migrations table, in the order of the
+// fields of record.
+var columns = []string{"version", "name", "checksum", "applied_at"}
+
+func quoteColumns(d torm.Dialect) string {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = d.Quote(col)
+	}
+	return strings.Join(quoted, ",")
+}
+
+// tableExists reports whether the migrations table has been created.
+func (m *Migrator) tableExists(ctx context.Context) (bool, error) {
+	d := torm.DialectOf(m.db)
+	var query string
+	var args []interface{}
+	switch d {
+	case torm.Postgres:
+		query, args = "SELECT to_regclass($1) IS NOT NULL", []interface{}{d.QuoteTable(m.table)}
+	case torm.SQLServer:
+		query, args = "SELECT CASE WHEN OBJECT_ID(@p1, N'U') IS NULL THEN 0 ELSE 1 END", []interface{}{m.table}
+	case torm.SQLite:
+		query, args = "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?", []interface{}{m.table}
+	default:
+		if schema, table, ok := strings.Cut(m.table, "."); ok {
+			query, args = "SELECT COUNT(*) > 0 FROM information_schema.tables WHERE table_schema = ? AND table_name = ?", []interface{}{schema, table}
+		} else {
+			query, args = "SELECT COUNT(*) > 0 FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", []interface{}{m.table}
+		}
+	}
+	var exists bool
+	err := m.db.QueryRowxContext(ctx, query, args...).Scan(&exists)
+	return exists, err
+}
+
+// createTable creates the migrations table unless it exists.
+func (m *Migrator) createTable(ctx context.Context) error {
+	d := torm.DialectOf(m.db)
+	types := []string{"BIGINT", "VARCHAR(255)", "VARCHAR(64)", "DATETIME"}
+	switch d {
+	case torm.Postgres:
+		types[3] = "TIMESTAMP WITH TIME ZONE"
+	case torm.SQLite:
+		types = []string{"INTEGER", "TEXT", "TEXT", "DATETIME"}
+	case torm.SQLServer:
+		types = []string{"BIGINT", "NVARCHAR(255)", "NVARCHAR(64)", "DATETIME2"}
+	}
+	lines := make([]string, len(columns))
+	for i, col := range columns {
+		lines[i] = d.Quote(col) + " " + types[i] + " NOT NULL"
+	}
+	body := " (\n  " + strings.Join(lines, ",\n  ") + ",\n  PRIMARY KEY (" + d.Quote("version") + ")\n)"
+
+	var query string
+	switch d {
+	case torm.SQLServer:
+		query = "IF OBJECT_ID(N'" + strings.ReplaceAll(m.table, "'", "''") + "', N'U') IS NULL CREATE TABLE " + d.QuoteTable(m.table) + body
+	default:
+		query = "CREATE TABLE IF NOT EXISTS " + d.QuoteTable(m.table) + body
+	}
+	_, err := m.db.ExecContext(ctx, query)
+	return err
+}
@@ -0,0 +1,304 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm"
+	"github.com/pinnacles/torm/migrate"
+	"github.com/pinnacles/torm/tormtest"
+)
+
+var (
+	applied = time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	columns = []string{"version", "name", "checksum", "applied_at"}
+)
+
+func migrations(t *testing.T) []migrate.Migration {
+	t.Helper()
+	ms, err := migrate.LoadFS(os.DirFS("testdata"), "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(ms, migrate.Migration{
+		Version: 3,
+		Name:    "backfill",
+		Up: func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, "UPDATE users SET email = LOWER(email)")
+			return err
+		},
+		Down: func(ctx context.Context, tx *sqlx.Tx) error { return nil },
+	})
+}
+
+func newMigrator(t *testing.T, h *tormtest.Handler) *migrate.Migrator {
+	t.Helper()
+	h.OnQuery("GET_LOCK", []string{"locked"}, []interface{}{int64(1)})
+	m, err := migrate.New(h.DB, migrations(t), migrate.WithNow(func() time.Time { return applied }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestLoadFS(t *testing.T) {
+	ms := migrations(t)
+	if len(ms) != 3 || ms[0].Version != 1 || ms[0].Name != "create_users" || ms[1].Down != nil || ms[0].Checksum == "" {
+		t.Fatalf("unexpected migrations %+v", ms)
+	}
+
+	h := tormtest.NewHandler(t, torm.MySQL)
+	tx := h.MustBegin()
+	if err := ms[0].Up(context.Background(), tx); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	got := h.Statements()
+	if len(got) != 4 || got[2].Query != "INSERT INTO users (email) VALUES ('root@example.com; admin')" {
+		t.Errorf("got statements %+v", got)
+	}
+}
+
+func TestSQLMigrationBackslash(t *testing.T) {
+	for d, want := range map[torm.Dialect][]string{
+		torm.Postgres: {`INSERT INTO t VALUES ('C:\')`, `INSERT INTO t VALUES (E'it\'s; x')`},
+		torm.MySQL:    {`INSERT INTO t VALUES ('C:\'); INSERT INTO t VALUES (E'it\'s; x')`},
+	} {
+		h := tormtest.NewHandler(t, d)
+		m := migrate.SQLMigration(1, "paths", `INSERT INTO t VALUES ('C:\'); INSERT INTO t VALUES (E'it\'s; x');`, "")
+		tx := h.MustBegin()
+		if err := m.Up(context.Background(), tx); err != nil {
+			t.Fatal(err)
+		}
+		tx.Rollback()
+		var got []string
+		for _, s := range h.Statements()[1:] {
+			if s.Query != "ROLLBACK" {
+				got = append(got, s.Query)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestUp(t *testing.T) {
+	ctx := context.Background()
+	h := tormtest.NewHandler(t, torm.MySQL)
+	m := newMigrator(t, h)
+	h.OnQuery("FROM `schema_migrations`", columns, []interface{}{int64(1), "create_users", migrations(t)[0].Checksum, applied})
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	h.AssertGolden(t, "up")
+}
+
+func TestUpTo(t *testing.T) {
+	ctx := context.Background()
+	h := tormtest.NewHandler(t, torm.MySQL)
+	m := newMigrator(t, h)
+
+	if err := m.UpTo(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	var inserted []interface{}
+	for _, s := range h.Statements() {
+		if s.Query == "INSERT INTO `schema_migrations` (`version`,`name`,`checksum`,`applied_at`) VALUES (?,?,?,?)" {
+			inserted = append(inserted, s.Args[0])
+		}
+	}
+	if !reflect.DeepEqual(inserted, []interface{}{int64(1)}) {
+		t.Errorf("got versions %v applied, want [1]", inserted)
+	}
+}
+
+func TestUpChecksumMismatch(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.MySQL)
+	m := newMigrator(t, h)
+	h.OnQuery("FROM `schema_migrations`", columns, []interface{}{int64(1), "create_users", "edited", applied})
+
+	if err := m.Up(context.Background()); !errors.Is(err, migrate.ErrChecksumMismatch) {
+		t.Errorf("got %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestUpLocked(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.MySQL)
+	h.OnQuery("GET_LOCK", []string{"locked"}, []interface{}{int64(0)})
+	m, err := migrate.New(h.DB, migrations(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); !errors.Is(err, migrate.ErrLocked) {
+		t.Errorf("got %v, want ErrLocked", err)
+	}
+}
+
+func TestLockTimeoutRoundedUp(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.MySQL)
+	h.OnQuery("GET_LOCK", []string{"locked"}, []interface{}{int64(1)})
+	m, err := migrate.New(h.DB, nil, migrate.WithLockTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := h.Statements()[0]; !reflect.DeepEqual(s.Args, []interface{}{"torm_migrate:schema_migrations", int64(1)}) {
+		t.Errorf("got %s with %v", s.Query, s.Args)
+	}
+}
+
+func TestUpFailure(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.MySQL)
+	m := newMigrator(t, h)
+	boom := errors.New("boom")
+	h.OnError("CREATE UNIQUE INDEX", boom)
+
+	if err := m.Up(context.Background()); !errors.Is(err, boom) {
+		t.Fatalf("got %v, want boom", err)
+	}
+	h.AssertGolden(t, "up_failure")
+}
+
+func TestDownAndRedo(t *testing.T) {
+	ctx := context.Background()
+	h := tormtest.NewHandler(t, torm.MySQL)
+	m := newMigrator(t, h)
+	ms := migrations(t)
+	h.OnQuery("FROM `schema_migrations`", columns,
+		[]interface{}{int64(1), "create_users", ms[0].Checksum, applied},
+		[]interface{}{int64(3), "backfill", "", applied},
+	)
+
+	if err := m.Down(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Redo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	h.AssertGolden(t, "down_redo")
+}
+
+func TestDownIrreversible(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.MySQL)
+	m := newMigrator(t, h)
+	h.OnQuery("FROM `schema_migrations`", columns, []interface{}{int64(2), "index_email", migrations(t)[1].Checksum, applied})
+
+	if err := m.Down(context.Background()); !errors.Is(err, migrate.ErrIrreversible) {
+		t.Errorf("got %v, want ErrIrreversible", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.Postgres)
+	m, err := migrate.New(h.DB, migrations(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.OnQuery("to_regclass", []string{"exists"}, []interface{}{true})
+	h.OnQuery(`FROM "schema_migrations"`, columns,
+		[]interface{}{int64(1), "create_users", "edited", applied},
+		[]interface{}{int64(7), "dropped", "", applied},
+	)
+
+	got, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []migrate.Status{
+		{Version: 1, Name: "create_users", Applied: true, AppliedAt: applied, Modified: true},
+		{Version: 2, Name: "index_email"},
+		{Version: 3, Name: "backfill"},
+		{Version: 7, Name: "dropped", Applied: true, AppliedAt: applied, Missing: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+	// Status only reads: no lock and no CREATE TABLE.
+	for _, s := range h.Statements() {
+		if strings.Contains(s.Query, "lock") || strings.HasPrefix(s.Query, "CREATE") {
+			t.Errorf("Status ran %s", s.Query)
+		}
+	}
+}
+
+func TestStatusWithoutTable(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.MySQL)
+	h.OnQuery("information_schema.tables", []string{"exists"}, []interface{}{int64(0)})
+	m, err := migrate.New(h.DB, migrations(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Applied {
+		t.Errorf("got %+v", got)
+	}
+	if n := len(h.Statements()); n != 1 {
+		t.Errorf("got %d statements, want 1", n)
+	}
+}
+
+func TestCreateTable(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.Postgres)
+	h.OnQuery("pg_try_advisory_lock", []string{"locked"}, []interface{}{true})
+	m, err := migrate.New(h.DB, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if q := h.Statements()[1].Query; q != "CREATE TABLE IF NOT EXISTS \"schema_migrations\" (\n  \"version\" BIGINT NOT NULL,\n  \"name\" VARCHAR(255) NOT NULL,\n  \"checksum\" VARCHAR(64) NOT NULL,\n  \"applied_at\" TIMESTAMP WITH TIME ZONE NOT NULL,\n  PRIMARY KEY (\"version\")\n)" {
+		t.Errorf("got create statement\n%s", q)
+	}
+}
+
+func TestSingleConnection(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.MySQL)
+	h.DB.SetMaxOpenConns(1)
+	m := newMigrator(t, h)
+	if err := m.Up(context.Background()); !errors.Is(err, migrate.ErrSingleConn) {
+		t.Errorf("got %v, want ErrSingleConn", err)
+	}
+}
+
+func TestSQLiteLock(t *testing.T) {
+	h := tormtest.NewHandler(t, torm.SQLite)
+	h.DB.SetMaxOpenConns(1)
+	h.OnExec("INSERT OR IGNORE", 1, 0)
+	m, err := migrate.New(h.DB, migrations(t)[2:], migrate.WithNow(func() time.Time { return applied }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	h.AssertGolden(t, "sqlite_up")
+}
+
+func TestTableNotRegistered(t *testing.T) {
+	for _, table := range torm.Tables() {
+		if table == migrate.DefaultTable {
+			t.Errorf("%s is registered with torm", table)
+		}
+	}
+}
+
+func TestNewDuplicateVersion(t *testing.T) {
+	ms := migrations(t)
+	if _, err := migrate.New(nil, append(ms, ms[0])); err == nil {
+		t.Error("New accepted a duplicate version")
+	}
+}
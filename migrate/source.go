@@ -0,0 +1,174 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pinnacles/torm"
+)
+
+// LoadFS reads the SQL migrations of dir in fsys, which is typically an
+// embed.FS. Files are named <version>_<name>.up.sql and
+// <version>_<name>.down.sql; the down file is optional and files that do
+// not end in .sql are skipped.
+func LoadFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	type files struct {
+		name     string
+		up, down string
+		hasUp    bool
+	}
+	byVersion := map[int64]*files{}
+	var versions []int64
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		base, direction := strings.TrimSuffix(base, path.Ext(base)), strings.TrimPrefix(path.Ext(base), ".")
+		v, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migrate: %s is not named <version>_<name>.up.sql or <version>_<name>.down.sql", e.Name())
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		f, ok := byVersion[version]
+		if !ok {
+			f = &files{name: name}
+			byVersion[version] = f
+			versions = append(versions, version)
+		}
+		if f.name != name {
+			return nil, fmt.Errorf("migrate: version %d is used by %s and %s", version, f.name, name)
+		}
+		if direction == "up" {
+			f.up, f.hasUp = string(b), true
+		} else {
+			f.down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(versions))
+	for _, v := range versions {
+		f := byVersion[v]
+		if !f.hasUp {
+			return nil, fmt.Errorf("migrate: %d_%s has no up file", v, f.name)
+		}
+		migrations = append(migrations, SQLMigration(v, f.name, f.up, f.down))
+	}
+	return migrations, nil
+}
+
+// splitStatements splits script at the semicolons that end statements of
+// dialect d, leaving those inside quotes, comments and Postgres dollar
+// quoting alone.
+func splitStatements(script string, d torm.Dialect) []string {
+	var stmts []string
+	start := 0
+	add := func(end int) {
+		if s := strings.TrimSpace(script[start:end]); s != "" && !onlyComments(s) {
+			stmts = append(stmts, s)
+		}
+	}
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(script, i, c, backslashEscapes(d, script, i))
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			i = skipTo(script, i, "\n")
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			i = skipTo(script, i+2, "*/")
+		case c == '$':
+			if tag, ok := dollarTag(script[i:]); ok {
+				i = skipTo(script, i+len(tag), tag)
+			}
+		case c == ';':
+			add(i)
+			start = i + 1
+		}
+	}
+	add(len(script))
+	return stmts
+}
+
+// backslashEscapes reports whether a backslash escapes the next byte in
+// the string quoted at i: in MySQL strings, and in Postgres only in E'...'
+// strings since standard conforming strings take backslashes literally.
+func backslashEscapes(d torm.Dialect, s string, i int) bool {
+	switch {
+	case s[i] == '`':
+		return false
+	case d == torm.MySQL:
+		return true
+	case d == torm.Postgres && s[i] == '\'':
+		return i > 0 && (s[i-1] == 'E' || s[i-1] == 'e') && (i == 1 || !isIdentByte(s[i-2]))
+	}
+	return false
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// skipQuoted returns the index of the quote closing the one at i, where a
+// doubled quote is part of the text and, with escapes, a backslash escapes
+// the byte after it.
+func skipQuoted(s string, i int, q byte, escapes bool) int {
+	for i++; i < len(s); i++ {
+		if s[i] == '\\' && escapes {
+			i++
+			continue
+		}
+		if s[i] == q {
+			if i+1 < len(s) && s[i+1] == q {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(s)
+}
+
+// skipTo returns the index of the last byte of the first end after i.
+func skipTo(s string, i int, end string) int {
+	j := strings.Index(s[i:], end)
+	if j < 0 {
+		return len(s)
+	}
+	return i + j + len(end) - 1
+}
+
+// dollarTag returns the $tag$ s starts with.
+func dollarTag(s string) (string, bool) {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '$':
+			return s[:i+1], true
+		case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 1 && '0' <= c && c <= '9':
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func onlyComments(s string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
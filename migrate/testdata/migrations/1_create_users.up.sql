@@ -0,0 +1,7 @@
+-- users sign in with their email.
+CREATE TABLE users (
+  id BIGINT NOT NULL AUTO_INCREMENT,
+  email VARCHAR(191) NOT NULL,
+  PRIMARY KEY (id)
+);
+INSERT INTO users (email) VALUES ('root@example.com; admin');
@@ -0,0 +1,244 @@
+package torm
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// maxPlans bounds the plans cached per table. Statements past it are built
+// every time, so callers generating field lists on the fly cannot grow the
+// cache without limit.
+const maxPlans = 256
+
+type planKind uint8
+
+const (
+	insertPlan planKind = iota
+	updatePlan
+	selectPlan
+	deletePlan
+)
+
+type planKey struct {
+	kind    planKind
+	dialect Dialect
+	fields  string
+}
+
+// sqlPlan is the part of a statement that only depends on the table, the
+// requested fields and the dialect, so it is built once and reused. Plans
+// are cached for the registered table name; head and tail are the query
+// around the quoted table name, for statements that emit another one.
+type sqlPlan struct {
+	query string
+	head  string
+	tail  string
+	// columns are the columns the statement writes or reads.
+	columns []string
+	// stamp holds the index paths of the auto time fields that the
+	// statement fills in.
+	stamp [][]int
+}
+
+// plan returns the plan of a statement on table, the emitted table name,
+// or on the registered one when table is "".
+func (m *tableMeta) plan(kind planKind, d Dialect, table string, fields []string) *sqlPlan {
+	p := m.cachedPlan(kind, d, fields)
+	if table == "" || table == m.TableName {
+		return p
+	}
+	return &sqlPlan{
+		query:   p.head + d.QuoteTable(table) + p.tail,
+		head:    p.head,
+		tail:    p.tail,
+		columns: p.columns,
+		stamp:   p.stamp,
+	}
+}
+
+func (m *tableMeta) cachedPlan(kind planKind, d Dialect, fields []string) *sqlPlan {
+	key := planKey{kind: kind, dialect: d, fields: fieldsKey(fields)}
+	if p, ok := m.plans.Load(key); ok {
+		return p.(*sqlPlan)
+	}
+
+	var p *sqlPlan
+	switch kind {
+	case insertPlan:
+		p = m.insertPlan(d, fields)
+	case updatePlan:
+		p = m.updatePlan(d, fields)
+	case selectPlan:
+		p = m.selectPlan(d, fields)
+	case deletePlan:
+		p = &sqlPlan{head: "DELETE FROM "}
+	}
+	p.query = p.head + d.QuoteTable(m.TableName) + p.tail
+	if m.planCount.Load() >= maxPlans {
+		return p
+	}
+	actual, loaded := m.plans.LoadOrStore(key, p)
+	if !loaded {
+		m.planCount.Add(1)
+	}
+	return actual.(*sqlPlan)
+}
+
+func (m *tableMeta) insertPlan(d Dialect, fields []string) *sqlPlan {
+	p := &sqlPlan{}
+	var cols []string
+	if len(fields) <= 0 {
+		for _, f := range m.Fields {
+			if m.IsAutoIncrement(f) {
+				continue
+			}
+			cols = append(cols, f)
+		}
+		for _, tf := range m.autoCreateTime {
+			p.stamp = append(p.stamp, tf.index)
+		}
+		for _, tf := range m.autoUpdateTime {
+			p.stamp = append(p.stamp, tf.index)
+		}
+	} else {
+		cols = cloneFields(fields)
+		for _, col := range m.Fields {
+			if (m.IsAutoCreateTime(col) || m.IsAutoUpdateTime(col) || m.isTenant(col)) && !containsField(fields, col) {
+				cols = append(cols, col)
+			}
+		}
+		for _, tf := range m.autoCreateTime {
+			if !containsField(fields, tf.column) {
+				p.stamp = append(p.stamp, tf.index)
+			}
+		}
+		for _, tf := range m.autoUpdateTime {
+			if !containsField(fields, tf.column) {
+				p.stamp = append(p.stamp, tf.index)
+			}
+		}
+	}
+
+	columns := make([]string, 0, len(cols))
+	names := make([]string, 0, len(cols))
+	for _, n := range cols {
+		columns = append(columns, d.Quote(n))
+		names = append(names, ":"+n)
+	}
+	p.columns = cols
+	p.head = "INSERT INTO "
+	p.tail = " (" + strings.Join(columns, ",") + ") VALUES (" + strings.Join(names, ",") + ")"
+	return p
+}
+
+func (m *tableMeta) updatePlan(d Dialect, fields []string) *sqlPlan {
+	p := &sqlPlan{}
+	var cols []string
+	if len(fields) <= 0 {
+		for _, f := range m.Fields {
+			if m.IsAutoIncrement(f) {
+				continue
+			}
+			if m.IsAutoCreateTime(f) {
+				continue
+			}
+			if m.isTenant(f) {
+				continue
+			}
+			cols = append(cols, f)
+		}
+		for _, tf := range m.autoUpdateTime {
+			p.stamp = append(p.stamp, tf.index)
+		}
+	} else {
+		cols = cloneFields(fields)
+		for _, col := range m.Fields {
+			if m.IsAutoUpdateTime(col) && !containsField(fields, col) {
+				cols = append(cols, col)
+			}
+		}
+		for _, tf := range m.autoUpdateTime {
+			if !containsField(fields, tf.column) {
+				p.stamp = append(p.stamp, tf.index)
+			}
+		}
+	}
+
+	sets := make([]string, 0, len(cols))
+	for _, n := range cols {
+		sets = append(sets, d.Quote(n)+"=:"+n)
+	}
+	p.columns = cols
+	p.head = "UPDATE "
+	p.tail = " SET " + strings.Join(sets, ",")
+	return p
+}
+
+func (m *tableMeta) selectPlan(d Dialect, fields []string) *sqlPlan {
+	selectColumns := []string{"*"}
+	columns := m.Fields
+	if len(fields) > 0 {
+		if fields[0] != "*" {
+			selectColumns = cloneFields(fields)
+			columns = selectColumns
+		}
+	} else {
+		selectColumns = m.Fields
+	}
+	quoted := make([]string, 0, len(selectColumns))
+	for _, col := range selectColumns {
+		if col == "*" {
+			quoted = append(quoted, col)
+		} else {
+			quoted = append(quoted, d.Quote(col))
+		}
+	}
+	return &sqlPlan{head: "SELECT " + strings.Join(quoted, ",") + " FROM ", columns: columns}
+}
+
+func (m *tableMeta) isTenant(col string) bool {
+	return m.tenant != nil && m.tenant.column == col
+}
+
+// stamp sets the auto time fields listed in paths to ts, or to the current
+// time when ts is nil. Values that are not addressable are left untouched.
+func (m *tableMeta) stamp(s Schema, paths [][]int, ts *time.Time) {
+	if len(paths) <= 0 {
+		return
+	}
+	elem := dereference(reflect.ValueOf(s))
+	if elem.Type() != m.typ || !elem.CanSet() {
+		return
+	}
+	now := time.Now()
+	if ts != nil {
+		now = *ts
+	}
+	v := reflect.ValueOf(now)
+	for _, index := range paths {
+		elem.FieldByIndex(index).Set(v)
+	}
+}
+
+// fieldsKey joins fields into a cache key without allocating for the common
+// cases of zero or one field.
+func fieldsKey(fields []string) string {
+	switch len(fields) {
+	case 0:
+		return ""
+	case 1:
+		return fields[0]
+	default:
+		return strings.Join(fields, "\x00")
+	}
+}
+
+func containsField(fields []string, col string) bool {
+	for _, f := range fields {
+		if f == col {
+			return true
+		}
+	}
+	return false
+}
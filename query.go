@@ -2,103 +2,119 @@ package torm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
-	"strings"
+	"sync"
 
 	"github.com/jmoiron/sqlx"
-	log "github.com/sirupsen/logrus"
 )
 
 type KV map[string]interface{}
 
 type selectBuilder struct {
-	h      handler
+	t      *Builder
 	fields []string
+	table  string
 }
 
-func newSelect(h handler, f ...string) *selectBuilder {
+func newSelect(t *Builder, f ...string) *selectBuilder {
 	return &selectBuilder{
-		h:      h,
-		fields: f,
+		t:      t,
+		fields: cloneFields(f),
 	}
 }
 
+// Table makes the query read from the table name instead of the one of the
+// result schema, whose registration is still used.
+func (s *selectBuilder) Table(name string) *selectBuilder {
+	c := *s
+	c.table = name
+	return &c
+}
+
 func (s *selectBuilder) Where(clause string, kv KV) *querySelectBuilder {
 	return &querySelectBuilder{
-		h:      s.h,
+		t:      s.t,
 		fields: s.fields,
 		clause: clause,
 		kv:     kv,
+		table:  s.table,
 	}
 }
 
 func (s *selectBuilder) Query(ctx context.Context, res interface{}) error {
 	q := &querySelectBuilder{
-		h:      s.h,
+		t:      s.t,
 		fields: s.fields,
+		table:  s.table,
 	}
 	return q.Query(ctx, res)
 }
 
+func (s *selectBuilder) QueryAll(ctx context.Context, res interface{}) error {
+	q := &querySelectBuilder{
+		t:      s.t,
+		fields: s.fields,
+		table:  s.table,
+	}
+	return q.QueryAll(ctx, res)
+}
+
 type querySelectBuilder struct {
-	h      handler
+	t      *Builder
 	fields []string
 	clause string
 	kv     KV
+	table  string
+}
+
+func (q *querySelectBuilder) Table(name string) *querySelectBuilder {
+	c := *q
+	c.table = name
+	return &c
 }
 
+// ToSQL is ToSQLContext with context.Background(), under which
+// TableNameFor and tenant scoping see no context values; the SQL can differ
+// from the one Query runs with its ctx.
 func (q *querySelectBuilder) ToSQL(res interface{}) (*SQL, error) {
+	return q.toSQL(context.Background(), res)
+}
+
+// ToSQLContext returns the statement Query runs with ctx.
+func (q *querySelectBuilder) ToSQLContext(ctx context.Context, res interface{}) (*SQL, error) {
+	return q.toSQL(ctx, res)
+}
 
+func (q *querySelectBuilder) toSQL(ctx context.Context, res interface{}) (*SQL, error) {
 	if reflect.TypeOf(res).Kind() != reflect.Ptr {
 		return nil, fmt.Errorf("Query must be specified Ptr type")
 	}
 
-	var meta *tableMeta
-	switch reflect.TypeOf(res).Elem().Kind() {
-	case reflect.Slice:
-		s, ok := interface{}(reflect.New(reflect.TypeOf(res).Elem().Elem()).Interface()).(Schema)
-		if !ok {
-			return nil, fmt.Errorf("res is expected to pass schema type or slice of schema")
-		}
-		meta = metas[s.TableName()]
-	default:
-		s, ok := res.(Schema)
-		if !ok {
-			return nil, fmt.Errorf("res is expected to pass schema type or slice of schema")
-		}
-		meta = metas[s.TableName()]
+	meta, err := resultMeta(reflect.TypeOf(res))
+	if err != nil {
+		return nil, err
 	}
 
-	selectColumns := []string{"*"}
-	if len(q.fields) > 0 {
-		if q.fields[0] != "*" {
-			selectColumns = q.fields
-		}
-	} else {
-		selectColumns = meta.Fields
-	}
-	quoted := make([]string, 0, len(selectColumns))
-	for _, col := range selectColumns {
-		qcol := ""
-		if col == "*" {
-			qcol = col
-		} else {
-			qcol = fmt.Sprintf("`%s`", col)
+	d := dialectOf(q.t.base(meta))
+	clause, kv := q.clause, q.kv
+	if meta.tenant != nil {
+		if kv, err = tenantKV(ctx, kv); err != nil {
+			return nil, err
 		}
-		quoted = append(quoted, qcol)
+		clause = tenantClause(d, clause, meta.tenant.column, tenantParam)
 	}
 
-	syntax := []string{fmt.Sprintf("SELECT %s FROM `%s`", strings.Join(quoted, ","), meta.TableName)}
+	table := elemTableName(ctx, q.table, reflect.TypeOf(res))
+	p := meta.plan(selectPlan, d, table, q.fields)
+	query := p.query
 	args := []interface{}{}
-	if q.clause != "" {
-		syntax = append(syntax, fmt.Sprintf("WHERE %s", q.clause))
-		query, params, err := sqlx.Named(strings.Join(syntax, " "), q.kv)
+	if clause != "" {
+		query, args, err = sqlx.Named(query+" WHERE "+clause, kv)
 		if err != nil {
 			return nil, err
 		}
-		syntax = []string{query}
-		args = params
 	}
 
 	asSliceForIn := false
@@ -109,29 +125,59 @@ func (q *querySelectBuilder) ToSQL(res interface{}) (*SQL, error) {
 		}
 	}
 
-	var query string
-	var params []interface{}
+	params := args
 	if asSliceForIn {
-		var err error
-		query, params, err = sqlx.In(syntax[0], args...)
+		query, params, err = sqlx.In(query, args...)
 		if err != nil {
 			return nil, err
 		}
-		query = q.h.Rebind(query)
-	} else {
-		query = syntax[0]
-		params = args
 	}
+	query = rebind(q.t.base(meta), query)
 
-	log.Infof("SQL: %s values: %#v", query, params)
-	return &SQL{
+	sql := &SQL{
 		Query: query,
 		Args:  params,
-	}, nil
+		op:    newOp(OpSelect, meta, table, p.columns),
+	}
+	if len(meta.sensitive) > 0 && clause != "" {
+		sql.sensitive = true
+		sql.mask = meta.argMask(clause, kv, asSliceForIn)
+	}
+	return sql, nil
+}
+
+// resultMetas caches the table metadata looked up for result types, so that
+// repeated queries skip instantiating the element type.
+var resultMetas sync.Map
+
+func resultMeta(rt reflect.Type) (*tableMeta, error) {
+	if m, ok := resultMetas.Load(rt); ok {
+		return m.(*tableMeta), nil
+	}
+
+	var meta *tableMeta
+	switch rt.Elem().Kind() {
+	case reflect.Slice:
+		s, ok := interface{}(reflect.New(rt.Elem().Elem()).Interface()).(Schema)
+		if !ok {
+			return nil, fmt.Errorf("res is expected to pass schema type or slice of schema")
+		}
+		meta = metas[s.TableName()]
+	default:
+		s, ok := reflect.New(rt.Elem()).Interface().(Schema)
+		if !ok {
+			return nil, fmt.Errorf("res is expected to pass schema type or slice of schema")
+		}
+		meta = metas[s.TableName()]
+	}
+	if meta != nil {
+		resultMetas.Store(rt, meta)
+	}
+	return meta, nil
 }
 
 func (q *querySelectBuilder) Query(ctx context.Context, res interface{}) error {
-	sql, err := q.ToSQL(res)
+	sql, err := q.toSQL(ctx, res)
 	if err != nil {
 		return err
 	}
@@ -144,9 +190,70 @@ func (q *querySelectBuilder) Query(ctx context.Context, res interface{}) error {
 		resIsSlice = false
 	}
 
-	if resIsSlice {
-		return q.h.SelectContext(ctx, res, sql.Query, sql.Args...)
-	} else {
-		return q.h.GetContext(ctx, res, sql.Query, sql.Args...)
+	meta, err := resultMeta(reflect.TypeOf(res))
+	if err != nil {
+		return err
+	}
+	h, err := q.t.kvTarget(ctx, meta, q.clause, q.kv)
+	if err != nil {
+		return err
+	}
+	return q.t.query(ctx, h, res, sql, resIsSlice)
+}
+
+// QueryAll is Query for sharded tables that runs on every shard and appends
+// the rows of all of them to res, which must be a pointer to a slice. Rows
+// are merged in shard order; ordering and limits apply per shard. On tables
+// that are not sharded it is the same as Query. Within a transaction of one
+// shard it fails with ErrShardTx, as the other shards can't be read in it.
+func (q *querySelectBuilder) QueryAll(ctx context.Context, res interface{}) error {
+	sql, err := q.toSQL(ctx, res)
+	if err != nil {
+		return err
+	}
+
+	rt := reflect.TypeOf(res)
+	if rt.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("QueryAll must be specified Ptr type of slice")
+	}
+	meta, err := resultMeta(rt)
+	if err != nil {
+		return err
+	}
+	if meta.shards == nil {
+		return q.t.query(ctx, q.t.target(ctx, false), res, sql, true)
+	}
+
+	dbs := meta.shards.dbs
+	rows := make([]reflect.Value, len(dbs))
+	errs := make([]error, len(dbs))
+	var wg sync.WaitGroup
+	for i, db := range dbs {
+		wg.Add(1)
+		go func(i int, db *sqlx.DB) {
+			defer wg.Done()
+			dest := reflect.New(rt.Elem())
+			h, err := q.t.shardTarget(ctx, meta, db)
+			if err != nil {
+				errs[i] = fmt.Errorf("shard %d: %w", i, err)
+				return
+			}
+			if err := q.t.query(ctx, h, dest.Interface(), sql, true); err != nil {
+				errs[i] = fmt.Errorf("shard %d: %w", i, err)
+				return
+			}
+			rows[i] = dest.Elem()
+		}(i, db)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	out := reflect.ValueOf(res).Elem()
+	for _, r := range rows {
+		out = reflect.AppendSlice(out, r)
 	}
+	reflect.ValueOf(res).Elem().Set(out)
+	return nil
 }
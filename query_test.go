@@ -98,3 +98,16 @@ func TestSeletWithWhere(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func BenchmarkSelectToSQL(b *testing.B) {
+	q := NewBuilder(nil).Select().Where("foo = :foo", KV{"foo": 1})
+	ts := []test.TestSchema{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := q.ToSQL(&ts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package torm
+
+import (
+	"reflect"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Redacted replaces the values of `torm:"sensitive"` columns in log entries.
+const Redacted = "[REDACTED]"
+
+// LogPolicy decides what the arguments of logged statements look like.
+type LogPolicy int32
+
+const (
+	// LogValues logs arguments with sensitive values redacted.
+	LogValues LogPolicy = iota
+	// LogShape logs the SQL only, without any argument.
+	LogShape
+)
+
+var logPolicy atomic.Int32
+
+// SetLogPolicy sets the policy applied to the entries of every Logger.
+func SetLogPolicy(p LogPolicy) {
+	logPolicy.Store(int32(p))
+}
+
+func (m *tableMeta) isSensitive(col string) bool {
+	_, ok := m.sensitive[col]
+	return ok
+}
+
+// argMask tells, for every positional argument that binding clause to
+// names produces, whether it may hold the value of a sensitive column. in
+// is set when the arguments are expanded by sqlx.In afterwards. A nil mask
+// means the arguments couldn't be told apart.
+func (m *tableMeta) argMask(clause string, names map[string]interface{}, in bool) []bool {
+	compared := comparedColumns(clause)
+	probe := make(map[string]interface{}, len(names))
+	for k, v := range names {
+		sensitive := m.isSensitive(k) || m.sensitiveParam(compared[k])
+		if rv := reflect.ValueOf(v); in && rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+			mask := make([]bool, rv.Len())
+			for i := range mask {
+				mask[i] = sensitive
+			}
+			probe[k] = mask
+			continue
+		}
+		probe[k] = sensitive
+	}
+
+	query, args, err := sqlx.Named(clause, probe)
+	if err == nil && in {
+		_, args, err = sqlx.In(query, args...)
+	}
+	if err != nil {
+		return nil
+	}
+	mask := make([]bool, len(args))
+	for i, arg := range args {
+		mask[i] = arg.(bool)
+	}
+	return mask
+}
+
+// sensitiveParam tells whether a parameter compared with cols may hold a
+// sensitive value: it is compared with a sensitive column, or with
+// something that is not a plain column, like SHA2(password) or a LIMIT,
+// which is masked to be safe.
+func (m *tableMeta) sensitiveParam(cols []string) bool {
+	if len(cols) == 0 {
+		return true
+	}
+	for _, col := range cols {
+		if col == "" || m.isSensitive(col) {
+			return true
+		}
+	}
+	return false
+}
+
+const columnPattern = "([A-Za-z_][\\w.]*|`[^`]+`|\"[^\"]+\"|\\[[^\\]]+\\])"
+
+var (
+	// paramBefore matches a comparison of a column that ends right before
+	// a placeholder: "col = ", "col LIKE ", "col IN (:a, ".
+	paramBefore = regexp.MustCompile(columnPattern + `\s*(?:=|<>|!=|<=|>=|<|>|\s(?i:NOT\s+)?(?i:LIKE|IN))\s*(?:\(\s*(?::[\w.]+\s*,\s*)*)?$`)
+	// paramAfter matches a comparison with a column right after a
+	// placeholder: " = col".
+	paramAfter = regexp.MustCompile(`^\s*(?:=|<>|!=|<=|>=|<|>)\s*` + columnPattern + `(?:\s|\)|$)`)
+)
+
+// comparedColumns maps the named parameters of clause to the columns they
+// are compared with, "" for a use that is not a comparison with a column.
+func comparedColumns(clause string) map[string][]string {
+	compared := map[string][]string{}
+	var quote byte
+	for i := 0; i < len(clause); i++ {
+		c := clause[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			continue
+		case c != ':':
+			continue
+		}
+		if i+1 < len(clause) && clause[i+1] == ':' {
+			// a :: cast
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(clause) && (isWordByte(clause[j]) || clause[j] == '.') {
+			j++
+		}
+		if j == i+1 {
+			continue
+		}
+		name := clause[i+1 : j]
+		col := ""
+		if sub := paramBefore.FindStringSubmatch(clause[:i]); sub != nil {
+			col = sub[1]
+		} else if sub := paramAfter.FindStringSubmatch(clause[j:]); sub != nil {
+			col = sub[1]
+		}
+		compared[name] = append(compared[name], unquoteColumn(col))
+		i = j - 1
+	}
+	return compared
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// columnNames maps every column of m to nil, for argMask.
+func (m *tableMeta) columnNames() map[string]interface{} {
+	names := make(map[string]interface{}, len(m.Fields)+1)
+	for _, col := range m.Fields {
+		names[col] = nil
+	}
+	return names
+}
+
+// redactArgs returns the arguments of s as they may be logged.
+func redactArgs(s *SQL) []interface{} {
+	if LogPolicy(logPolicy.Load()) == LogShape {
+		return nil
+	}
+	if s.sensitive {
+		args := make([]interface{}, len(s.Args))
+		for i, arg := range s.Args {
+			if s.mask == nil || s.mask[i] {
+				arg = Redacted
+			}
+			args[i] = arg
+		}
+		return args
+	}
+	if len(s.Args) == 1 {
+		if schema, ok := s.Args[0].(Schema); ok {
+			if meta, ok := metas[schema.TableName()]; ok && len(meta.sensitive) > 0 {
+				return []interface{}{meta.redact(schema)}
+			}
+		}
+	}
+	return s.Args
+}
+
+// redact dumps the columns of s, with the sensitive ones redacted.
+func (m *tableMeta) redact(s Schema) map[string]interface{} {
+	elem := dereference(reflect.ValueOf(s))
+	if elem.Type() != m.typ {
+		return map[string]interface{}{"schema": Redacted}
+	}
+	dump := make(map[string]interface{}, len(m.Fields))
+	for i, col := range m.Fields {
+		f := elem.FieldByIndex(m.fieldIndex[i])
+		switch {
+		case m.isSensitive(col):
+			dump[col] = Redacted
+		case f.CanInterface():
+			dump[col] = f.Interface()
+		}
+	}
+	return dump
+}
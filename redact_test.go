@@ -0,0 +1,126 @@
+package torm
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+type credentialSchema struct {
+	ID       int    `db:"id" torm:"autoIncrement"`
+	Email    string `db:"email"`
+	Password string `db:"password" torm:"sensitive"`
+	Token    string `db:"token" torm:"sensitive"`
+}
+
+func (s credentialSchema) TableName() string {
+	return "credentials"
+}
+
+func init() {
+	Register(credentialSchema{})
+}
+
+func TestRedactSensitive(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `credentials` (`email`,`password`,`token`) VALUES (?,?,?)")).
+			WithArgs("a@example.com", "hash", "tok").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `credentials` WHERE email = ? AND token = ?")).
+			WithArgs("a@example.com", "tok").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `id` FROM `credentials` WHERE token IN (?, ?) AND email = ?")).
+			WithArgs("t1", "t2", "a@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		l := &recordLogger{}
+		builder := NewBuilder(db, WithLogger(l))
+		s := credentialSchema{Email: "a@example.com", Password: "hash", Token: "tok"}
+		if _, err := builder.Insert("email", "password", "token").Exec(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := builder.Delete().Where("email = :email AND token = :token").Exec(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+		rows := []credentialSchema{}
+		if err := builder.Select("id").Where("token IN (:token) AND email = :email", KV{"token": []string{"t1", "t2"}, "email": "a@example.com"}).Query(ctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+
+		dump := l.entries[0].Args[0].(map[string]interface{})
+		if dump["email"] != "a@example.com" || dump["password"] != Redacted || dump["token"] != Redacted {
+			t.Errorf("unexpected insert dump %v", dump)
+		}
+		if args := l.entries[1].Args; args[0] != "a@example.com" || args[1] != Redacted {
+			t.Errorf("unexpected delete args %v", args)
+		}
+		if args := l.entries[2].Args; args[0] != Redacted || args[1] != Redacted || args[2] != "a@example.com" {
+			t.Errorf("unexpected select args %v", args)
+		}
+		if s.Password != "hash" {
+			t.Errorf("redaction changed the schema: %+v", s)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogShape(t *testing.T) {
+	SetLogPolicy(LogShape)
+	defer SetLogPolicy(LogValues)
+
+	if args := redactArgs(&SQL{Query: "SELECT 1 WHERE foo = ?", Args: []interface{}{1}}); args != nil {
+		t.Errorf("got args %v, want none", args)
+	}
+}
+
+func TestRegisterTagOptions(t *testing.T) {
+	meta := metas["credentials"]
+	if !meta.isSensitive("password") || meta.isSensitive("email") {
+		t.Errorf("unexpected sensitive columns %v", meta.sensitive)
+	}
+	Register(optionSchema{})
+	meta = metas["tag_options"]
+	if meta.tenant == nil || meta.tenant.column != "tenant_id" || !meta.isSensitive("tenant_id") {
+		t.Errorf("combined tag options were not all applied: %+v", meta)
+	}
+}
+
+type optionSchema struct {
+	TenantID int    `db:"tenant_id" torm:"tenant;sensitive"`
+	Name     string `db:"name"`
+}
+
+func (s optionSchema) TableName() string {
+	return "tag_options"
+}
+
+func TestRedactComparedParams(t *testing.T) {
+	Register(credentialSchema{})
+	m := metas["credentials"]
+	for _, c := range []struct {
+		clause string
+		kv     KV
+		want   []bool
+	}{
+		{"password = :pw AND email = :e", KV{"pw": "secret", "e": "a@example.com"}, []bool{true, false}},
+		{"`credentials`.`token` <> :t", KV{"t": "tok"}, []bool{true}},
+		{":e = email OR :t = token", KV{"e": "a@example.com", "t": "tok"}, []bool{false, true}},
+		{"token IN (:a, :b) AND id > :id", KV{"a": "t1", "b": "t2", "id": 3}, []bool{true, true, false}},
+		{"password = SHA2(:pw, 256)", KV{"pw": "secret"}, []bool{true}},
+		{"email LIKE :e LIMIT :n", KV{"e": "a%", "n": 10}, []bool{false, true}},
+	} {
+		got := m.argMask(c.clause, c.kv, false)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("argMask(%q) is %v, %v was expected", c.clause, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// TxOption configures how Transaction runs.
+type TxOption func(*txConfig)
+
+type txConfig struct {
+	retry        *RetryPolicy
+	panicAsError bool
+	tracer       Tracer
+	// span is the span of the running transaction, if traced.
+	span Span
+}
+
+func newTxConfig(options []TxOption) *txConfig {
+	cfg := &txConfig{}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// RetryPolicy re-runs a transaction on a fresh tx when it fails with a
+// retryable error, such as a deadlock or a serialization failure. The
+// transaction body must therefore be safe to run more than once.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one.
+	MaxAttempts int
+	// BaseDelay is the backoff before the second attempt. It doubles for
+	// every further attempt, up to MaxDelay, and is fully jittered.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Retryable classifies errors. IsRetryable is used when it is nil.
+	Retryable func(error) bool
+}
+
+// WithRetry retries the transaction according to p. Retries only apply to
+// the outermost transaction; savepoints are never retried on their own.
+func WithRetry(p RetryPolicy) TxOption {
+	return func(cfg *txConfig) {
+		cfg.retry = &p
+	}
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// backoff returns the delay to wait after the given failed attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func (p *RetryPolicy) wait(ctx context.Context, attempt int) error {
+	d := p.backoff(attempt)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// sqlStater is implemented by errors that carry a SQLSTATE, such as the
+// *pq.Error of lib/pq and the *pgconn.PgError of pgx.
+type sqlStater interface {
+	SQLState() string
+}
+
+// IsRetryable reports whether err is a serialization failure or deadlock
+// reported through SQLSTATE 40001/40P01, or a MySQL deadlock (1213) or lock
+// wait timeout (1205). torm doesn't import drivers, so MySQL errors, whose
+// *mysql.MySQLError has no SQLState method, are recognized by the
+// "Error 1213" and "Error 1205" their message starts with; the SQLSTATE
+// forms are matched in messages as well, for drivers without SQLState.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var state sqlStater
+	if errors.As(err, &state) {
+		return retryableState(state.SQLState())
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "Error 1213") || strings.Contains(msg, "Error 1205") || strings.Contains(msg, "SQLSTATE 40001") || strings.Contains(msg, "SQLSTATE 40P01")
+}
+
+func retryableState(state string) bool {
+	return state == "40001" || state == "40P01"
+}
@@ -0,0 +1,135 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+type stateError string
+
+func (e stateError) Error() string    { return "state " + string(e) }
+func (e stateError) SQLState() string { return string(e) }
+
+func TestIsRetryable(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("Error 1213 (40001): Deadlock found when trying to get lock"), true},
+		{errors.New("Error 1062 (23000): Duplicate entry"), false},
+		{stateError("40001"), true},
+		{stateError("40P01"), true},
+		{stateError("23505"), false},
+		{errors.Join(errors.New("wrapped"), stateError("40001")), true},
+		{fmt.Errorf("exec: %w", errors.New("Error 1205: Lock wait timeout exceeded; try restarting transaction")), true},
+		{fmt.Errorf("exec: %w", stateError("40P01")), true},
+		{errors.New("ERROR: could not serialize access (SQLSTATE 40001)"), true},
+	} {
+		if got := IsRetryable(c.err); got != c.want {
+			t.Errorf("IsRetryable(%v) is %v, %v was expected", c.err, got, c.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 25 * time.Millisecond}
+	for attempt := 1; attempt <= 5; attempt++ {
+		if d := p.backoff(attempt); d < 0 || d > p.MaxDelay {
+			t.Errorf("backoff(%d) is %s", attempt, d)
+		}
+	}
+	if d := (&RetryPolicy{}).backoff(3); d != 0 {
+		t.Errorf("backoff without BaseDelay is %s", d)
+	}
+}
+
+func TestTransactionRetry(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `test`").WithArgs(1).WillReturnError(errors.New("Error 1213 (40001): Deadlock found"))
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `test`").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		attempts := 0
+		if err := NewBuilder(db).Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+			attempts++
+			_, err := b.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1})
+			return err
+		}, WithRetry(RetryPolicy{MaxAttempts: 3})); err != nil {
+			t.Fatal(err)
+		}
+		if attempts != 2 {
+			t.Errorf("attempts is %d, 2 was expected", attempts)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionRetryExhausted(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		for i := 0; i < 2; i++ {
+			mock.ExpectBegin()
+			mock.ExpectRollback()
+		}
+
+		deadlock := stateError("40001")
+		attempts := 0
+		err := Transaction(ctx, nil, db, func(tx *sqlx.Tx) error {
+			attempts++
+			return deadlock
+		}, WithRetry(RetryPolicy{MaxAttempts: 2}))
+		if attempts != 2 {
+			t.Errorf("attempts is %d, 2 was expected", attempts)
+		}
+		if !errors.Is(err, deadlock) {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !strings.Contains(err.Error(), "attempt 1: ") || !strings.Contains(err.Error(), "attempt 2: ") {
+			t.Errorf("errors of every attempt were expected: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionRetryNotRetryable(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		want := errors.New("proc error")
+		attempts := 0
+		err := Transaction(ctx, nil, db, func(tx *sqlx.Tx) error {
+			attempts++
+			return want
+		}, WithRetry(RetryPolicy{MaxAttempts: 3, Retryable: func(err error) bool {
+			return errors.Is(err, context.DeadlineExceeded)
+		}}))
+		if attempts != 1 || err != want {
+			t.Errorf("attempts is %d and error is %v", attempts, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,241 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrCrossShard      = errors.New("torm: statement doesn't resolve to a single shard, use QueryAll to query every shard")
+	ErrCrossShardWrite = errors.New("torm: update or delete on a sharded table doesn't constrain the shard key with column = :column")
+	ErrShardTx         = errors.New("torm: transaction is not on the shard the statement resolves to")
+)
+
+// ShardResolver maps a shard key to the index of the shard it lives on.
+type ShardResolver func(key interface{}) (int, error)
+
+// ModResolver resolves integer shard keys to key modulo n.
+func ModResolver(n int) ShardResolver {
+	return func(key interface{}) (int, error) {
+		v := reflect.ValueOf(key)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i := v.Int() % int64(n)
+			if i < 0 {
+				i += int64(n)
+			}
+			return int(i), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int(v.Uint() % uint64(n)), nil
+		default:
+			return 0, fmt.Errorf("torm: shard key %#v is not an integer", key)
+		}
+	}
+}
+
+type shardSet struct {
+	column  string
+	index   []int
+	dbs     []*sqlx.DB
+	resolve ShardResolver
+}
+
+// RegisterShards registers s and declares its table sharded over dbs by the
+// value of column, which resolve maps to an index of dbs. Inserts, updates
+// and deletes take the key from the schema, selects from the KV of their
+// where clause. The where clause of updates and deletes has to compare
+// column with :column, so they cannot touch rows of other shards.
+func RegisterShards(s Schema, column string, dbs []*sqlx.DB, resolve ShardResolver) {
+	if len(dbs) <= 0 {
+		panic("RegisterShards is must be given at least one shard")
+	}
+	Register(s)
+	meta := metas[s.TableName()]
+
+	var index []int
+	for i := 0; i < meta.typ.NumField(); i++ {
+		field := meta.typ.Field(i)
+		if field.Tag.Get("db") == column {
+			index = field.Index
+			break
+		}
+	}
+	if index == nil {
+		panic(fmt.Sprintf("RegisterShards is must be given a column of %s", meta.TableName))
+	}
+
+	meta.shards = &shardSet{
+		column:  column,
+		index:   index,
+		dbs:     dbs,
+		resolve: resolve,
+	}
+}
+
+func (s *shardSet) db(key interface{}) (*sqlx.DB, error) {
+	i, err := s.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(s.dbs) {
+		return nil, fmt.Errorf("torm: shard %d is out of range", i)
+	}
+	return s.dbs[i], nil
+}
+
+func (s *shardSet) forSchema(meta *tableMeta, sc Schema) (*sqlx.DB, error) {
+	elem := dereference(reflect.ValueOf(sc))
+	if elem.Type() != meta.typ {
+		return nil, fmt.Errorf("torm: %T is not registered for sharded table %s", sc, meta.TableName)
+	}
+	return s.db(elem.FieldByIndex(s.index).Interface())
+}
+
+// forKV resolves the shard of a select. A slice value, as used with IN, is
+// allowed as long as all of its elements live on the same shard.
+func (s *shardSet) forKV(kv KV) (*sqlx.DB, error) {
+	key, ok := kv[s.column]
+	if !ok {
+		return nil, ErrCrossShard
+	}
+	v := reflect.ValueOf(key)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return s.db(key)
+	}
+
+	var db *sqlx.DB
+	for i := 0; i < v.Len(); i++ {
+		d, err := s.db(v.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if db != nil && d != db {
+			return nil, ErrCrossShard
+		}
+		db = d
+	}
+	if db == nil {
+		return nil, ErrCrossShard
+	}
+	return db, nil
+}
+
+// base returns the handler that decides the dialect of statements on the
+// table of meta.
+func (t *Builder) base(meta *tableMeta) handler {
+	if meta.shards != nil {
+		return meta.shards.dbs[0]
+	}
+	return t.h
+}
+
+// constrains reports whether clause limits a statement to the rows of the
+// shard key it is routed by: one of its top level AND terms has to compare
+// the shard column with :column, the parameter bound to the key, using =
+// or IN.
+func (s *shardSet) constrains(clause string) bool {
+	pred, _ := splitClause(clause)
+	param := ":" + s.column
+	for _, term := range splitTop(trimParens(pred), "AND") {
+		term = trimParens(term)
+		if in := splitTop(term, "IN"); len(in) == 2 {
+			if trimParens(in[1]) == param && unquoteColumn(strings.TrimSpace(in[0])) == s.column {
+				return true
+			}
+			continue
+		}
+		lhs, rhs, ok := strings.Cut(term, "=")
+		if !ok || strings.ContainsAny(lhs, "<>!") || strings.HasPrefix(rhs, "=") {
+			continue
+		}
+		lhs, rhs = strings.TrimSpace(lhs), strings.TrimSpace(rhs)
+		if lhs == param {
+			lhs, rhs = rhs, lhs
+		}
+		if rhs == param && unquoteColumn(lhs) == s.column {
+			return true
+		}
+	}
+	return false
+}
+
+// unquoteColumn strips the table qualifier and identifier quotes of col.
+func unquoteColumn(col string) string {
+	if i := strings.LastIndexByte(col, '.'); i >= 0 {
+		col = col[i+1:]
+	}
+	return strings.Trim(col, "`\"[]")
+}
+
+// shardTarget returns the transaction a statement routed to db joins: the
+// transaction the builder is bound to, or the one ctx carries. It has to be
+// a transaction of db; running on db instead would leave it. Without a
+// transaction the statement runs on db.
+func (t *Builder) shardTarget(ctx context.Context, meta *tableMeta, db *sqlx.DB) (handler, error) {
+	if tx, ok := t.h.(*sqlx.Tx); ok {
+		if scope := scopeOfTx(tx); scope != nil && scope.db == handler(db) {
+			return tx, nil
+		}
+		return nil, ErrShardTx
+	}
+	scope := txFromContext(ctx)
+	if scope == nil {
+		return db, nil
+	}
+	if scope.db == handler(db) {
+		return scope.tx, nil
+	}
+	if scope.db == t.h {
+		return nil, ErrShardTx
+	}
+	for _, shard := range meta.shards.dbs {
+		if scope.db == handler(shard) {
+			return nil, ErrShardTx
+		}
+	}
+	return db, nil
+}
+
+// schemaTarget is target for writes of s, routed by shard key when its
+// table is sharded.
+func (t *Builder) schemaTarget(ctx context.Context, meta *tableMeta, s Schema) (handler, error) {
+	if meta.shards == nil {
+		return t.target(ctx, true), nil
+	}
+	db, err := meta.shards.forSchema(meta, s)
+	if err != nil {
+		return nil, err
+	}
+	return t.shardTarget(ctx, meta, db)
+}
+
+// whereTarget is schemaTarget for updates and deletes, whose clause has to
+// keep them on the shard of s.
+func (t *Builder) whereTarget(ctx context.Context, meta *tableMeta, s Schema, clause string) (handler, error) {
+	if meta.shards != nil && !meta.shards.constrains(clause) {
+		return nil, ErrCrossShardWrite
+	}
+	return t.schemaTarget(ctx, meta, s)
+}
+
+// kvTarget is target for selects, routed by the shard key in kv when the
+// table is sharded. The clause has to filter on the key, or rows of other
+// shards would be missed silently.
+func (t *Builder) kvTarget(ctx context.Context, meta *tableMeta, clause string, kv KV) (handler, error) {
+	if meta.shards == nil {
+		return t.target(ctx, false), nil
+	}
+	if !meta.shards.constrains(clause) {
+		return nil, ErrCrossShard
+	}
+	db, err := meta.shards.forKV(kv)
+	if err != nil {
+		return nil, err
+	}
+	return t.shardTarget(ctx, meta, db)
+}
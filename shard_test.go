@@ -0,0 +1,213 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+type shardedSchema struct {
+	ID     int `db:"id" torm:"autoIncrement"`
+	UserID int `db:"user_id"`
+	Score  int `db:"score"`
+}
+
+func (s shardedSchema) TableName() string {
+	return "sharded"
+}
+
+func withShards(t *testing.T, proc func(ctx context.Context, dbs []*sqlx.DB, mocks []sqlmock.Sqlmock)) {
+	dbs := []*sqlx.DB{}
+	mocks := []sqlmock.Sqlmock{}
+	for i := 0; i < 2; i++ {
+		mdb, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mdb.Close()
+		dbs = append(dbs, sqlx.NewDb(mdb, "mysql"))
+		mocks = append(mocks, mock)
+	}
+	RegisterShards(shardedSchema{}, "user_id", dbs, ModResolver(len(dbs)))
+	defer Register(shardedSchema{})
+
+	proc(context.Background(), dbs, mocks)
+
+	for _, mock := range mocks {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestShardRouting(t *testing.T) {
+	withShards(t, func(ctx context.Context, dbs []*sqlx.DB, mocks []sqlmock.Sqlmock) {
+		mocks[1].ExpectExec(regexp.QuoteMeta("INSERT INTO `sharded` (`user_id`,`score`) VALUES (?,?)")).
+			WithArgs(3, 10).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mocks[0].ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`score` FROM `sharded` WHERE user_id IN (?, ?)")).
+			WithArgs(2, 4).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2).AddRow(4))
+
+		builder := NewBuilder(nil)
+		if _, err := builder.Insert().Exec(ctx, &shardedSchema{UserID: 3, Score: 10}); err != nil {
+			t.Fatal(err)
+		}
+		rows := []shardedSchema{}
+		if err := builder.Select().Where("user_id IN (:user_id)", KV{"user_id": []int{2, 4}}).Query(ctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 2 {
+			t.Errorf("length of rows is %d, 2 was expected", len(rows))
+		}
+	})
+}
+
+func TestShardCrossShard(t *testing.T) {
+	withShards(t, func(ctx context.Context, dbs []*sqlx.DB, mocks []sqlmock.Sqlmock) {
+		builder := NewBuilder(nil)
+		rows := []shardedSchema{}
+		if err := builder.Select().Where("score > :score", KV{"score": 1}).Query(ctx, &rows); !errors.Is(err, ErrCrossShard) {
+			t.Errorf("ErrCrossShard was expected: %v", err)
+		}
+		if err := builder.Select().Where("user_id IN (:user_id)", KV{"user_id": []int{1, 2}}).Query(ctx, &rows); !errors.Is(err, ErrCrossShard) {
+			t.Errorf("ErrCrossShard was expected: %v", err)
+		}
+		// a key in kv doesn't help when the clause doesn't filter on it.
+		if err := builder.Select().Where("score > :score", KV{"score": 5, "user_id": 3}).Query(ctx, &rows); !errors.Is(err, ErrCrossShard) {
+			t.Errorf("ErrCrossShard was expected: %v", err)
+		}
+		if err := builder.Select().Where("user_id = :user_id OR score > :score", KV{"score": 5, "user_id": 3}).Query(ctx, &rows); !errors.Is(err, ErrCrossShard) {
+			t.Errorf("ErrCrossShard was expected: %v", err)
+		}
+	})
+}
+
+func TestShardQueryAll(t *testing.T) {
+	withShards(t, func(ctx context.Context, dbs []*sqlx.DB, mocks []sqlmock.Sqlmock) {
+		for i, mock := range mocks {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`score` FROM `sharded` WHERE score > ?")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(i).AddRow(i + 2))
+		}
+
+		rows := []shardedSchema{}
+		if err := NewBuilder(nil).Select().Where("score > :score", KV{"score": 1}).QueryAll(ctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 4 || rows[0].UserID != 0 || rows[3].UserID != 3 {
+			t.Errorf("unexpected rows: %#v", rows)
+		}
+	})
+}
+
+func TestShardTransaction(t *testing.T) {
+	withShards(t, func(ctx context.Context, dbs []*sqlx.DB, mocks []sqlmock.Sqlmock) {
+		mocks[0].ExpectBegin()
+		mocks[0].ExpectExec(regexp.QuoteMeta("DELETE FROM `sharded` WHERE user_id = ?")).
+			WithArgs(2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mocks[0].ExpectCommit()
+
+		if err := NewBuilder(dbs[0]).Transaction(ctx, nil, func(ctx context.Context, _ *Builder) error {
+			_, err := NewBuilder(nil).Delete().Where("user_id = :user_id").Exec(ctx, &shardedSchema{UserID: 2})
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestModResolver(t *testing.T) {
+	r := ModResolver(3)
+	for key, want := range map[interface{}]int{4: 1, int64(-1): 2, uint8(9): 0} {
+		if got, err := r(key); err != nil || got != want {
+			t.Errorf("ModResolver(3)(%v) is %d, %v", key, got, err)
+		}
+	}
+	if _, err := r("a"); err == nil {
+		t.Error("error was expected for a string key")
+	}
+}
+
+func TestShardBuilderTransaction(t *testing.T) {
+	withShards(t, func(ctx context.Context, dbs []*sqlx.DB, mocks []sqlmock.Sqlmock) {
+		mocks[0].ExpectBegin()
+		mocks[0].ExpectExec(regexp.QuoteMeta("INSERT INTO `sharded` (`user_id`,`score`) VALUES (?,?)")).
+			WithArgs(2, 10).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mocks[0].ExpectRollback()
+
+		err := Transaction(ctx, nil, dbs[0], func(tx *sqlx.Tx) error {
+			builder := NewBuilder(tx)
+			if _, err := builder.Insert().Exec(ctx, &shardedSchema{UserID: 2, Score: 10}); err != nil {
+				t.Fatal(err)
+			}
+			_, err := builder.Insert().Exec(ctx, &shardedSchema{UserID: 3, Score: 10})
+			return err
+		})
+		if !errors.Is(err, ErrShardTx) {
+			t.Errorf("ErrShardTx was expected: %v", err)
+		}
+	})
+}
+
+func TestShardContextTransaction(t *testing.T) {
+	withShards(t, func(ctx context.Context, dbs []*sqlx.DB, mocks []sqlmock.Sqlmock) {
+		mocks[0].ExpectBegin()
+		mocks[0].ExpectRollback()
+
+		err := NewBuilder(dbs[0]).Transaction(ctx, nil, func(ctx context.Context, _ *Builder) error {
+			_, err := NewBuilder(nil).Delete().Where("user_id = :user_id").Exec(ctx, &shardedSchema{UserID: 3})
+			return err
+		})
+		if !errors.Is(err, ErrShardTx) {
+			t.Errorf("ErrShardTx was expected: %v", err)
+		}
+	})
+}
+
+func TestShardQueryAllTransaction(t *testing.T) {
+	withShards(t, func(ctx context.Context, dbs []*sqlx.DB, mocks []sqlmock.Sqlmock) {
+		mocks[0].ExpectBegin()
+		mocks[0].ExpectQuery(regexp.QuoteMeta("SELECT `id`,`user_id`,`score` FROM `sharded` WHERE score > ?")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2))
+		mocks[0].ExpectRollback()
+
+		err := NewBuilder(dbs[0]).Transaction(ctx, nil, func(ctx context.Context, _ *Builder) error {
+			rows := []shardedSchema{}
+			return NewBuilder(nil).Select().Where("score > :score", KV{"score": 1}).QueryAll(ctx, &rows)
+		})
+		if !errors.Is(err, ErrShardTx) {
+			t.Errorf("ErrShardTx was expected: %v", err)
+		}
+	})
+}
+
+func TestShardCrossShardWrite(t *testing.T) {
+	withShards(t, func(ctx context.Context, dbs []*sqlx.DB, mocks []sqlmock.Sqlmock) {
+		mocks[1].ExpectExec(regexp.QuoteMeta("UPDATE `sharded` SET `score`=? WHERE `sharded`.`user_id` = ? AND score < 10")).
+			WithArgs(5, 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		builder := NewBuilder(nil)
+		s := &shardedSchema{UserID: 3, Score: 5}
+		if _, err := builder.Update("score").Where("score = :score").Exec(ctx, s); !errors.Is(err, ErrCrossShardWrite) {
+			t.Errorf("ErrCrossShardWrite was expected: %v", err)
+		}
+		if _, err := builder.Update("score").Where("user_id = :user_id OR score = 0").Exec(ctx, s); !errors.Is(err, ErrCrossShardWrite) {
+			t.Errorf("ErrCrossShardWrite was expected: %v", err)
+		}
+		if _, err := builder.Delete().All().Exec(ctx, s); !errors.Is(err, ErrCrossShardWrite) {
+			t.Errorf("ErrCrossShardWrite was expected: %v", err)
+		}
+		if _, err := builder.Update("score").Where("`sharded`.`user_id` = :user_id AND score < 10").Exec(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
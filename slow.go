@@ -0,0 +1,172 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SlowQueryConfig configures WithSlowQueryLog.
+type SlowQueryConfig struct {
+	// Threshold is the duration from which a statement counts as slow.
+	Threshold time.Duration
+	// Explain runs EXPLAIN for slow statements on the handler they ran on.
+	// EXPLAIN is one more round trip while the database is already slow,
+	// so it is meant for development and staging rather than production.
+	// It runs once the statement has returned through the interceptors, so
+	// metrics, spans and interceptors don't count it.
+	Explain bool
+	// ExplainInterval, if set, limits EXPLAIN to one slow statement per
+	// interval for the builders created with this config.
+	ExplainInterval time.Duration
+	// OnSlowQuery, if set, is called for every slow statement.
+	OnSlowQuery func(ctx context.Context, q SlowQuery)
+}
+
+// SlowQuery is a statement that took at least the configured threshold.
+// Args are redacted like the ones of log entries.
+type SlowQuery struct {
+	Op        Op
+	Query     string
+	Args      []interface{}
+	Duration  time.Duration
+	Threshold time.Duration
+
+	// Plan holds the rows EXPLAIN returned, when Explain is set. FullScan
+	// and Filesort flag plans that read a whole table or sort without an
+	// index.
+	Plan       []map[string]interface{}
+	FullScan   bool
+	Filesort   bool
+	ExplainErr error
+}
+
+// WithSlowQueryLog reports statements that take at least cfg.Threshold. Slow
+// statements are logged at warning level with their SlowQuery, and passed
+// to cfg.OnSlowQuery.
+func WithSlowQueryLog(cfg SlowQueryConfig) Option {
+	return func(b *Builder) {
+		b.slow = &slowLog{SlowQueryConfig: cfg}
+	}
+}
+
+// slowLog is the slow query config of a builder, and the state shared by
+// the builders derived from it.
+type slowLog struct {
+	SlowQueryConfig
+	// lastExplain is the UnixNano time of the last EXPLAIN.
+	lastExplain atomic.Int64
+}
+
+// allowExplain tells whether a slow statement may be explained now.
+func (l *slowLog) allowExplain(now time.Time) bool {
+	if !l.Explain {
+		return false
+	}
+	if l.ExplainInterval <= 0 {
+		return true
+	}
+	last := l.lastExplain.Load()
+	if last != 0 && now.Sub(time.Unix(0, last)) < l.ExplainInterval {
+		return false
+	}
+	return l.lastExplain.CompareAndSwap(last, now.UnixNano())
+}
+
+func (t *Builder) isSlow(d time.Duration) bool {
+	return t.slow != nil && d >= t.slow.Threshold
+}
+
+var errNoExplain = errors.New("torm: EXPLAIN is not supported for this handler")
+
+type queryxer interface {
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+}
+
+// slowQuery returns the SlowQuery of s, which ran on h for d, or nil when
+// it wasn't slow. EXPLAIN runs with explainCtx.
+func (t *Builder) slowQuery(ctx, explainCtx context.Context, h handler, op Op, s *SQL, d time.Duration, err error) *SlowQuery {
+	if !t.isSlow(d) {
+		return nil
+	}
+	q := &SlowQuery{Op: op, Query: s.Query, Args: redactArgs(s), Duration: d, Threshold: t.slow.Threshold}
+	if err == nil && t.slow.allowExplain(time.Now()) {
+		q.explain(explainCtx, h, s)
+	}
+	if t.slow.OnSlowQuery != nil {
+		t.slow.OnSlowQuery(ctx, *q)
+	}
+	return q
+}
+
+func (q *SlowQuery) explain(ctx context.Context, h handler, s *SQL) {
+	x, ok := h.(queryxer)
+	d := dialectOf(h)
+	if !ok || d == SQLServer {
+		q.ExplainErr = errNoExplain
+		return
+	}
+
+	query, args := s.Query, s.Args
+	if len(args) == 1 {
+		if schema, ok := args[0].(Schema); ok {
+			var err error
+			if query, args, err = sqlx.Named(query, schema); err != nil {
+				q.ExplainErr = err
+				return
+			}
+			query = rebind(h, query)
+		}
+	}
+	prefix := "EXPLAIN "
+	if d == SQLite {
+		prefix = "EXPLAIN QUERY PLAN "
+	}
+
+	rows, err := x.QueryxContext(ctx, prefix+query, args...)
+	if err != nil {
+		q.ExplainErr = err
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := rows.MapScan(row); err != nil {
+			q.ExplainErr = err
+			return
+		}
+		for k, v := range row {
+			if b, ok := v.([]byte); ok {
+				row[k] = string(b)
+			}
+		}
+		q.Plan = append(q.Plan, row)
+		q.flag(d, row)
+	}
+	q.ExplainErr = rows.Err()
+}
+
+// flag sets FullScan and Filesort from a row of the plan.
+func (q *SlowQuery) flag(d Dialect, row map[string]interface{}) {
+	text := func(col string) string {
+		s, _ := row[col].(string)
+		return s
+	}
+	switch d {
+	case Postgres:
+		line := strings.TrimLeft(text("QUERY PLAN"), " ->")
+		q.FullScan = q.FullScan || strings.HasPrefix(line, "Seq Scan")
+		q.Filesort = q.Filesort || strings.HasPrefix(line, "Sort ") || strings.HasPrefix(line, "Incremental Sort ")
+	case SQLite:
+		detail := text("detail")
+		q.FullScan = q.FullScan || (strings.HasPrefix(detail, "SCAN ") && !strings.Contains(detail, " INDEX "))
+		q.Filesort = q.Filesort || strings.Contains(detail, "USE TEMP B-TREE FOR ORDER BY")
+	default:
+		q.FullScan = q.FullScan || strings.EqualFold(text("type"), "ALL")
+		q.Filesort = q.Filesort || strings.Contains(text("Extra"), "Using filesort")
+	}
+}
@@ -0,0 +1,160 @@
+package torm
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+func TestSlowQueryExplain(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		tm := time.Now()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `foo` FROM `test` WHERE foo = ? ORDER BY bar")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"foo"}).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN SELECT `foo` FROM `test` WHERE foo = ? ORDER BY bar")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "table", "type", "Extra"}).AddRow(1, "test", "ALL", "Using where; Using filesort"))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `test` SET `foo`=?,`updated_at`=? WHERE foo = ?")).
+			WithArgs(1, tm, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN UPDATE `test` SET `foo`=?,`updated_at`=? WHERE foo = ?")).
+			WithArgs(1, tm, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "table", "type", "Extra"}).AddRow(1, "test", "range", "Using where"))
+
+		var slow []SlowQuery
+		l := &recordLogger{}
+		builder := NewBuilder(db, WithLogger(l), WithSlowQueryLog(SlowQueryConfig{
+			Explain: true,
+			OnSlowQuery: func(ctx context.Context, q SlowQuery) {
+				slow = append(slow, q)
+			},
+		}))
+		builder.SetTime(&tm)
+		rows := []test.TestSchema{}
+		if err := builder.Select("foo").Where("foo = :foo ORDER BY bar", KV{"foo": 1}).Query(ctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := builder.Update("foo").Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(slow) != 2 {
+			t.Fatalf("got %d slow queries, want 2", len(slow))
+		}
+		if q := slow[0]; !q.FullScan || !q.Filesort || q.ExplainErr != nil || len(q.Plan) != 1 || q.Plan[0]["type"] != "ALL" || q.Op.Kind != OpSelect {
+			t.Errorf("unexpected select slow query %+v", q)
+		}
+		if q := slow[1]; q.FullScan || q.Filesort || q.ExplainErr != nil || q.Op.Kind != OpUpdate {
+			t.Errorf("unexpected update slow query %+v", q)
+		}
+		if e := l.entries[0]; e.Slow == nil || !e.Slow.FullScan {
+			t.Errorf("log entry is not marked slow: %+v", e)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSlowQueryThreshold(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		l := &recordLogger{}
+		called := false
+		builder := NewBuilder(db, WithLogger(l), WithSlowQueryLog(SlowQueryConfig{
+			Threshold:   time.Hour,
+			Explain:     true,
+			OnSlowQuery: func(ctx context.Context, q SlowQuery) { called = true },
+		}))
+		if _, err := builder.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if called || l.entries[0].Slow != nil {
+			t.Error("statement under the threshold was reported as slow")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSlowQueryFlags(t *testing.T) {
+	for _, c := range []struct {
+		d                  Dialect
+		row                map[string]interface{}
+		fullScan, filesort bool
+	}{
+		{MySQL, map[string]interface{}{"type": "ref", "Extra": "Using index"}, false, false},
+		{Postgres, map[string]interface{}{"QUERY PLAN": "Sort  (cost=1.0..2.0 rows=1 width=4)"}, false, true},
+		{Postgres, map[string]interface{}{"QUERY PLAN": "  ->  Seq Scan on test  (cost=0.00..1.01 rows=1 width=4)"}, true, false},
+		{SQLite, map[string]interface{}{"detail": "SCAN test"}, true, false},
+		{SQLite, map[string]interface{}{"detail": "SCAN test USING INDEX idx_foo"}, false, false},
+		{SQLite, map[string]interface{}{"detail": "USE TEMP B-TREE FOR ORDER BY"}, false, true},
+	} {
+		q := &SlowQuery{}
+		q.flag(c.d, c.row)
+		if q.FullScan != c.fullScan || q.Filesort != c.filesort {
+			t.Errorf("%s %v: full scan %v filesort %v, want %v %v", c.d, c.row, q.FullScan, q.Filesort, c.fullScan, c.filesort)
+		}
+	}
+}
+
+func TestSlowQueryExplainOutsideInterceptors(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		// the interval leaves room for a single EXPLAIN.
+		mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN DELETE FROM `test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "type"}).AddRow(1, "ALL"))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		var events []string
+		builder := NewBuilder(db,
+			WithInterceptors(func(ctx context.Context, op Op, s *SQL, next Invoker) (Result, error) {
+				res, err := next(ctx, op, s)
+				events = append(events, "returned")
+				return res, err
+			}),
+			WithSlowQueryLog(SlowQueryConfig{
+				Explain:         true,
+				ExplainInterval: time.Hour,
+				OnSlowQuery: func(ctx context.Context, q SlowQuery) {
+					events = append(events, "slow explained="+strconv.FormatBool(q.Plan != nil))
+				},
+			}),
+		)
+		for i := 0; i < 2; i++ {
+			if _, err := builder.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := []string{"returned", "slow explained=true", "returned", "slow explained=false"}
+		if !reflect.DeepEqual(events, want) {
+			t.Errorf("events are %v, %v was expected", events, want)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
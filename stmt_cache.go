@@ -0,0 +1,140 @@
+package torm
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type stmtKey struct {
+	h     handler
+	named bool
+	query string
+}
+
+type stmtEntry struct {
+	key  stmtKey
+	stmt *sqlx.NamedStmt
+	elem *list.Element
+	// refs counts the callers currently using stmt. An evicted entry is
+	// closed once the last of them releases it.
+	refs    int
+	evicted bool
+}
+
+// stmtCache is an LRU of prepared statements keyed by the generated SQL
+// and the handler they are prepared on.
+type stmtCache struct {
+	size int
+
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[stmtKey]*stmtEntry
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:    size,
+		ll:      list.New(),
+		entries: map[stmtKey]*stmtEntry{},
+	}
+}
+
+// acquire returns the cached statement for query, preparing it on h on a
+// miss.
+// Named statements are prepared with PrepareNamedContext; positional ones
+// are prepared with PreparexContext and wrapped so that both can be used
+// through the same type. Every acquire must be paired with a release.
+func (c *stmtCache) acquire(ctx context.Context, h handler, named bool, query string) (*stmtEntry, error) {
+	key := stmtKey{h: h, named: named, query: query}
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		e.refs++
+		c.ll.MoveToFront(e.elem)
+		c.mu.Unlock()
+		return e, nil
+	}
+	c.mu.Unlock()
+
+	stmt, err := prepare(ctx, h, named, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		// somebody else prepared the same statement in the meantime.
+		e.refs++
+		c.ll.MoveToFront(e.elem)
+		_ = stmt.Close()
+		return e, nil
+	}
+	e := &stmtEntry{key: key, stmt: stmt, refs: 1}
+	e.elem = c.ll.PushFront(e)
+	c.entries[key] = e
+	for c.ll.Len() > c.size {
+		c.evict(c.ll.Back().Value.(*stmtEntry))
+	}
+	return e, nil
+}
+
+func prepare(ctx context.Context, h handler, named bool, query string) (*sqlx.NamedStmt, error) {
+	if named {
+		return h.PrepareNamedContext(ctx, query)
+	}
+	stmt, err := h.(preparer).PreparexContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlx.NamedStmt{QueryString: query, Stmt: stmt}, nil
+}
+
+func (c *stmtCache) release(e *stmtEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.refs--
+	if e.evicted && e.refs <= 0 {
+		_ = e.stmt.Close()
+	}
+}
+
+// evict must be called with c.mu held.
+func (c *stmtCache) evict(e *stmtEntry) {
+	c.ll.Remove(e.elem)
+	delete(c.entries, e.key)
+	e.evicted = true
+	if e.refs <= 0 {
+		_ = e.stmt.Close()
+	}
+}
+
+// Len returns the number of cached statements.
+func (c *stmtCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Close evicts and closes every cached statement.
+func (c *stmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for c.ll.Len() > 0 {
+		e := c.ll.Back().Value.(*stmtEntry)
+		c.ll.Remove(e.elem)
+		delete(c.entries, e.key)
+		e.evicted = true
+		if e.refs <= 0 {
+			if err := e.stmt.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
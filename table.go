@@ -0,0 +1,56 @@
+package torm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+)
+
+// TableNamer is implemented by schemas whose table name depends on the
+// context, such as monthly partitions or per-tenant prefixes. TableName
+// still names the registration the metadata is taken from.
+type TableNamer interface {
+	TableNameFor(ctx context.Context) string
+}
+
+var tableNamerType = reflect.TypeOf((*TableNamer)(nil)).Elem()
+
+// tableName returns the table a statement on s is emitted for, or "" for
+// the registered one. An override given with Table wins over TableNameFor.
+func tableName(ctx context.Context, override string, s interface{}) string {
+	if override != "" {
+		return override
+	}
+	if n, ok := s.(TableNamer); ok {
+		return n.TableNameFor(ctx)
+	}
+	return ""
+}
+
+// elemTableName is tableName for the element type of a query result.
+func elemTableName(ctx context.Context, override string, rt reflect.Type) string {
+	if override != "" {
+		return override
+	}
+	elem := rt.Elem()
+	if elem.Kind() == reflect.Slice {
+		elem = elem.Elem()
+	}
+	if !reflect.PtrTo(elem).Implements(tableNamerType) {
+		return ""
+	}
+	return reflect.New(elem).Interface().(TableNamer).TableNameFor(ctx)
+}
+
+// QuoteTable quotes a table name that may be qualified with a database or
+// schema name, as in analytics.events.
+func (d Dialect) QuoteTable(name string) string {
+	if !strings.Contains(name, ".") {
+		return d.Quote(name)
+	}
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = d.Quote(p)
+	}
+	return strings.Join(parts, ".")
+}
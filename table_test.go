@@ -0,0 +1,136 @@
+package torm
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+type monthKey struct{}
+
+type eventSchema struct {
+	ID   int    `db:"id" torm:"autoIncrement"`
+	Name string `db:"name"`
+}
+
+func (s eventSchema) TableName() string {
+	return "events"
+}
+
+func (s eventSchema) TableNameFor(ctx context.Context) string {
+	if month, ok := ctx.Value(monthKey{}).(string); ok {
+		return "events_" + month
+	}
+	return ""
+}
+
+func init() {
+	Register(eventSchema{})
+}
+
+func TestTableOverride(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		tm := time.Now()
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `test_202610` (`foo`,`created_at`,`updated_at`) VALUES (?,?,?)")).
+			WithArgs(1, tm, tm).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `archive`.`test` SET `foo`=?,`updated_at`=? WHERE foo = ?")).
+			WithArgs(1, tm, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `test_202610` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `foo` FROM `archive`.`test` WHERE foo = ?")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"foo"}).AddRow(1))
+
+		builder := NewBuilder(db)
+		builder.SetTime(&tm)
+		ts := test.TestSchema{Foo: 1}
+		if _, err := builder.Insert("foo").Table("test_202610").Exec(ctx, &ts); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := builder.Update("foo").Table("archive.test").Where("foo = :foo").Exec(ctx, &ts); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := builder.Delete().Where("foo = :foo").Table("test_202610").Exec(ctx, &ts); err != nil {
+			t.Fatal(err)
+		}
+		rows := []test.TestSchema{}
+		if err := builder.Select("foo").Table("archive.test").Where("foo = :foo", KV{"foo": 1}).Query(ctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTableNameFor(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `events_202610` (`name`) VALUES (?)")).
+			WithArgs("signup").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`name` FROM `events_202610`")).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("signup"))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`name` FROM `events`")).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("signup"))
+
+		builder := NewBuilder(db)
+		mctx := context.WithValue(ctx, monthKey{}, "202610")
+		if _, err := builder.Insert().Exec(mctx, &eventSchema{Name: "signup"}); err != nil {
+			t.Fatal(err)
+		}
+		rows := []eventSchema{}
+		if err := builder.Select().Query(mctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.Select().Query(ctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQuoteTable(t *testing.T) {
+	if q := MySQL.QuoteTable("analytics.events"); q != "`analytics`.`events`" {
+		t.Errorf("unexpected quoted table: %s", q)
+	}
+	if q := Postgres.QuoteTable("events"); q != `"events"` {
+		t.Errorf("unexpected quoted table: %s", q)
+	}
+}
+
+func TestTableOverridePlans(t *testing.T) {
+	Register(eventSchema{})
+	m := metas["events"]
+	for _, month := range []string{"202609", "202610", "202611"} {
+		p := m.plan(insertPlan, MySQL, "events_"+month, nil)
+		if p.query != "INSERT INTO `events_"+month+"` (`name`) VALUES (:name)" {
+			t.Errorf("unexpected query: %s", p.query)
+		}
+	}
+	if n := m.planCount.Load(); n != 1 {
+		t.Errorf("got %d cached plans, want 1 for all table names", n)
+	}
+
+	ctx := context.WithValue(context.Background(), monthKey{}, "202610")
+	s, err := NewBuilder(nil).Insert().ToSQLContext(ctx, &eventSchema{Name: "signup"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Query != "INSERT INTO `events_202610` (`name`) VALUES (:name)" {
+		t.Errorf("unexpected query: %s", s.Query)
+	}
+}
@@ -0,0 +1,151 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pinnacles/torm/internal/conv"
+)
+
+var ErrMissingTenant = errors.New("torm: tenant table accessed without a tenant in context")
+
+type tenantKey struct{}
+
+// WithTenant returns a context that scopes statements on tenant tables,
+// those with a `torm:"tenant"` column, to tenant.
+func WithTenant(ctx context.Context, tenant interface{}) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func TenantFromContext(ctx context.Context) (interface{}, bool) {
+	tenant := ctx.Value(tenantKey{})
+	return tenant, tenant != nil
+}
+
+type tenantField struct {
+	column string
+	index  []int
+}
+
+// tenantParam is the KV name the tenant of a select is bound to.
+const tenantParam = "torm_tenant"
+
+// setTenant fills the tenant field of s with the tenant of ctx. When s
+// can't be written to, its tenant has to match the one of ctx already.
+func (m *tableMeta) setTenant(ctx context.Context, s Schema) error {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return ErrMissingTenant
+	}
+	elem := dereference(reflect.ValueOf(s))
+	if elem.Type() != m.typ {
+		return fmt.Errorf("torm: %T is not registered for tenant table %s", s, m.TableName)
+	}
+	f := elem.FieldByIndex(m.tenant.index)
+	v, ok := convertTenant(reflect.ValueOf(tenant), f.Type())
+	if !ok {
+		return fmt.Errorf("torm: tenant %#v can't be stored in %s.%s", tenant, m.TableName, m.tenant.column)
+	}
+	if f.CanSet() {
+		f.Set(v)
+		return nil
+	}
+	if !reflect.DeepEqual(f.Interface(), v.Interface()) {
+		return fmt.Errorf("torm: %s.%s of %T is not the tenant of the context", m.TableName, m.tenant.column, s)
+	}
+	return nil
+}
+
+// convertTenant converts v to t when that keeps its value: v is assignable
+// to t, both are strings, or both are numbers and v survives the round
+// trip. Conversions like int to string, which yields a rune, are refused.
+func convertTenant(v reflect.Value, t reflect.Type) (reflect.Value, bool) {
+	if v.Type().AssignableTo(t) {
+		return v, true
+	}
+	if v.Kind() == reflect.String && t.Kind() == reflect.String {
+		return v.Convert(t), true
+	}
+	return conv.Number(v, t)
+}
+
+// tenantKV returns a copy of kv with the tenant of ctx bound to tenantParam.
+func tenantKV(ctx context.Context, kv KV) (KV, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrMissingTenant
+	}
+	scoped := make(KV, len(kv)+1)
+	for k, v := range kv {
+		scoped[k] = v
+	}
+	scoped[tenantParam] = tenant
+	return scoped, nil
+}
+
+// tenantClause restricts clause to rows whose tenant column equals the
+// named parameter param. The predicate part of clause is parenthesized so
+// that its ORs can't escape the restriction; trailing ORDER BY, LIMIT and
+// the like are kept after it.
+func tenantClause(d Dialect, clause, column, param string) string {
+	pred, tail := splitClause(clause)
+	cond := d.Quote(column) + " = :" + param
+	if strings.TrimSpace(pred) != "" {
+		cond = "(" + pred + ") AND " + cond
+	}
+	if tail != "" {
+		cond += " " + tail
+	}
+	return cond
+}
+
+var clauseTails = []string{"GROUP BY", "HAVING", "ORDER BY", "LIMIT", "OFFSET", "FOR UPDATE", "FOR SHARE", "LOCK IN SHARE MODE"}
+
+// splitClause splits a where clause at the first keyword, outside of quotes
+// and parentheses, that ends the predicate.
+func splitClause(clause string) (string, string) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(clause); i++ {
+		c := clause[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			continue
+		case c == '(':
+			depth++
+			continue
+		case c == ')':
+			depth--
+			continue
+		}
+		if depth != 0 || (i > 0 && !isSpace(clause[i-1])) {
+			continue
+		}
+		for _, kw := range clauseTails {
+			if hasKeyword(clause[i:], kw) {
+				return strings.TrimSpace(clause[:i]), strings.TrimSpace(clause[i:])
+			}
+		}
+	}
+	return clause, ""
+}
+
+func hasKeyword(s, kw string) bool {
+	if len(s) < len(kw) || !strings.EqualFold(s[:len(kw)], kw) {
+		return false
+	}
+	return len(s) == len(kw) || isSpace(s[len(kw)])
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,153 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+type tenantSchema struct {
+	ID       int    `db:"id" torm:"autoIncrement"`
+	TenantID int    `db:"tenant_id" torm:"tenant"`
+	Name     string `db:"name"`
+}
+
+func (s tenantSchema) TableName() string {
+	return "accounts"
+}
+
+func init() {
+	Register(tenantSchema{})
+}
+
+func TestTenantScope(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `accounts` (`name`,`tenant_id`) VALUES (?,?)")).
+			WithArgs("a", 7).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE `accounts` SET `name`=? WHERE (id = ? OR name = ?) AND `tenant_id` = ?")).
+			WithArgs("a", 1, "a", 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `accounts` WHERE (id = ?) AND `tenant_id` = ? LIMIT 1")).
+			WithArgs(1, 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`tenant_id`,`name` FROM `accounts` WHERE (name = ? OR id = ?) AND `tenant_id` = ? ORDER BY id")).
+			WithArgs("a", 1, 7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "tenant_id", "name"}).AddRow(1, 7, "a"))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`tenant_id`,`name` FROM `accounts` WHERE `tenant_id` = ?")).
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "tenant_id", "name"}).AddRow(1, 7, "a"))
+
+		ctx = WithTenant(ctx, 7)
+		builder := NewBuilder(db)
+		s := tenantSchema{ID: 1, TenantID: 3, Name: "a"}
+		if _, err := builder.Insert("name").Exec(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+		if s.TenantID != 7 {
+			t.Errorf("tenant_id = %d, want 7", s.TenantID)
+		}
+		if _, err := builder.Update().Where("id = :id OR name = :name").Exec(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := builder.Delete().Where("id = :id LIMIT 1").Exec(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+		rows := []tenantSchema{}
+		if err := builder.Select().Where("name = :name OR id = :id ORDER BY id", KV{"name": "a", "id": 1}).Query(ctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.Select().Query(ctx, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTenantMissing(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		builder := NewBuilder(db)
+		s := tenantSchema{ID: 1, Name: "a"}
+		if _, err := builder.Insert().Exec(ctx, &s); !errors.Is(err, ErrMissingTenant) {
+			t.Errorf("insert: got %v, want ErrMissingTenant", err)
+		}
+		if _, err := builder.Update().Where("id = :id").Exec(ctx, &s); !errors.Is(err, ErrMissingTenant) {
+			t.Errorf("update: got %v, want ErrMissingTenant", err)
+		}
+		if _, err := builder.Delete().Where("id = :id").Exec(ctx, &s); !errors.Is(err, ErrMissingTenant) {
+			t.Errorf("delete: got %v, want ErrMissingTenant", err)
+		}
+		rows := []tenantSchema{}
+		if err := builder.Select().Query(ctx, &rows); !errors.Is(err, ErrMissingTenant) {
+			t.Errorf("select: got %v, want ErrMissingTenant", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTenantMismatch(t *testing.T) {
+	ctx := WithTenant(context.Background(), 7)
+	if _, err := NewBuilder(nil).Insert().ToSQL(tenantSchema{TenantID: 3}); err == nil {
+		t.Error("expected missing tenant for ToSQL without context")
+	}
+	if _, err := NewBuilder(nil).Insert().toSQL(ctx, tenantSchema{TenantID: 3}); err == nil {
+		t.Error("expected an error for a tenant that differs from the context")
+	}
+	if _, err := NewBuilder(nil).Insert().toSQL(ctx, tenantSchema{TenantID: 7}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSplitClause(t *testing.T) {
+	for _, c := range []struct{ clause, pred, tail string }{
+		{"a = 1", "a = 1", ""},
+		{"a = 1 ORDER BY id LIMIT 2", "a = 1", "ORDER BY id LIMIT 2"},
+		{"name = 'x order by y' limit 1", "name = 'x order by y'", "limit 1"},
+		{"id IN (SELECT id FROM t LIMIT 1)", "id IN (SELECT id FROM t LIMIT 1)", ""},
+		{"ORDER BY id", "", "ORDER BY id"},
+		{"limited = 1", "limited = 1", ""},
+	} {
+		pred, tail := splitClause(c.clause)
+		if pred != c.pred || tail != c.tail {
+			t.Errorf("splitClause(%q) = %q, %q; want %q, %q", c.clause, pred, tail, c.pred, c.tail)
+		}
+	}
+}
+
+func TestConvertTenant(t *testing.T) {
+	type code string
+	for _, c := range []struct {
+		tenant interface{}
+		to     interface{}
+		ok     bool
+	}{
+		{7, 0, true},
+		{int64(7), 0, true},
+		{7.0, 0, true},
+		{7.5, 0, false},
+		{-1, uint(0), false},
+		{300, int8(0), false},
+		{"acme", code(""), true},
+		{65, "", false},
+		{"7", 0, false},
+	} {
+		_, ok := convertTenant(reflect.ValueOf(c.tenant), reflect.TypeOf(c.to))
+		if ok != c.ok {
+			t.Errorf("convertTenant(%#v, %T) is %v, %v was expected", c.tenant, c.to, ok, c.ok)
+		}
+	}
+}
@@ -1,17 +1,16 @@
 package torm
 
 import (
-	"os"
+	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 )
 
-func init() {
-	logrus.SetOutput(os.Stdout)
-	logrus.SetLevel(logrus.WarnLevel)
-}
-
 var (
 	metas = map[string]*tableMeta{}
 )
@@ -25,42 +24,52 @@ type tableMeta struct {
 	AutoCreateTimeColumns map[string]string
 	HasAutoUpdateTime     bool
 	AutoUpdateTimeColumns map[string]string
+
+	// typ is the registered struct type. The index paths below are only
+	// valid for values of this type.
+	typ            reflect.Type
+	fieldIndex     [][]int
+	autoIncrement  map[string]struct{}
+	autoCreateTime []timeField
+	autoUpdateTime []timeField
+	plans          sync.Map
+	planCount      atomic.Int32
+	shards         *shardSet
+	tenant         *tenantField
+	sensitive      map[string]struct{}
+	references     map[string]string
+	columns        []columnDef
 }
 
-func (m tableMeta) IsAutoIncrement(col string) bool {
+// timeField is an auto time column and the index path of its struct field,
+// in registration order.
+type timeField struct {
+	column string
+	index  []int
+}
+
+func (m *tableMeta) IsAutoIncrement(col string) bool {
 	if !m.HasAutoIncrement {
 		return false
 	}
-	for _, key := range m.AutoIncrementColumns {
-		if key == col {
-			return true
-		}
-	}
-	return false
+	_, ok := m.autoIncrement[col]
+	return ok
 }
 
-func (m tableMeta) IsAutoCreateTime(col string) bool {
+func (m *tableMeta) IsAutoCreateTime(col string) bool {
 	if !m.HasAutoCreateTime {
 		return false
 	}
-	for k := range m.AutoCreateTimeColumns {
-		if k == col {
-			return true
-		}
-	}
-	return false
+	_, ok := m.AutoCreateTimeColumns[col]
+	return ok
 }
 
-func (m tableMeta) IsAutoUpdateTime(col string) bool {
+func (m *tableMeta) IsAutoUpdateTime(col string) bool {
 	if !m.HasAutoUpdateTime {
 		return false
 	}
-	for k := range m.AutoUpdateTimeColumns {
-		if k == col {
-			return true
-		}
-	}
-	return false
+	_, ok := m.AutoUpdateTimeColumns[col]
+	return ok
 }
 
 type Schema interface {
@@ -72,12 +81,20 @@ func Register(s Schema) {
 	rt := rv.Type()
 
 	fs := []string{}
+	fieldIndex := [][]int{}
 	hasAutoIncrement := false
 	autoIncrementColumns := []string{}
+	autoIncrement := map[string]struct{}{}
 	hasAutoCreateTime := false
 	autoCreateTimeColumns := map[string]string{}
+	autoCreateTime := []timeField{}
 	hasAutoUpdateTime := false
 	autoUpdateTimeColumns := map[string]string{}
+	autoUpdateTime := []timeField{}
+	var tenant *tenantField
+	sensitive := map[string]struct{}{}
+	references := map[string]string{}
+	columns := []columnDef{}
 
 	for i := 0; i < rt.NumField(); i++ {
 		field := rt.Field(i)
@@ -87,23 +104,57 @@ func Register(s Schema) {
 			continue
 		}
 		fs = append(fs, col)
-
-		fn := field.Tag.Get("torm")
-		if fn == "" {
-			continue
-		}
-		switch fn {
-		case "autoIncrement":
-			hasAutoIncrement = true
-			autoIncrementColumns = append(autoIncrementColumns, col)
-		case "autoCreateTime":
-			hasAutoCreateTime = true
-			autoCreateTimeColumns[col] = field.Name
-		case "autoUpdateTime":
-			hasAutoUpdateTime = true
-			autoUpdateTimeColumns[col] = field.Name
-		default:
+		fieldIndex = append(fieldIndex, field.Index)
+		def := columnDef{goType: field.Type}
+
+		for _, opt := range strings.Split(field.Tag.Get("torm"), ";") {
+			fn, value, _ := strings.Cut(strings.TrimSpace(opt), ":")
+			switch fn {
+			case "autoIncrement":
+				hasAutoIncrement = true
+				autoIncrementColumns = append(autoIncrementColumns, col)
+				autoIncrement[col] = struct{}{}
+			case "autoCreateTime":
+				hasAutoCreateTime = true
+				autoCreateTimeColumns[col] = field.Name
+				if field.Type.Kind() == reflect.Struct {
+					autoCreateTime = append(autoCreateTime, timeField{column: col, index: field.Index})
+				}
+			case "autoUpdateTime":
+				hasAutoUpdateTime = true
+				autoUpdateTimeColumns[col] = field.Name
+				if field.Type.Kind() == reflect.Struct {
+					autoUpdateTime = append(autoUpdateTime, timeField{column: col, index: field.Index})
+				}
+			case "tenant":
+				tenant = &tenantField{column: col, index: field.Index}
+			case "sensitive":
+				sensitive[col] = struct{}{}
+			case "references":
+				// references:table or references:table.column
+				references[col] = value
+			case "primaryKey":
+				def.primaryKey = true
+			case "type":
+				def.typ = value
+			case "size":
+				size, err := strconv.Atoi(value)
+				if err != nil || size <= 0 {
+					def.err = fmt.Errorf("size must be a positive integer, got %q", value)
+				}
+				def.size = size
+			case "default":
+				def.def, def.hasDefault = value, true
+			case "notNull":
+				def.notNull = true
+			case "unique":
+				def.unique = true
+			case "index":
+				def.indexes = append(def.indexes, value)
+			default:
+			}
 		}
+		columns = append(columns, def)
 	}
 
 	metas[s.TableName()] = &tableMeta{
@@ -115,19 +166,35 @@ func Register(s Schema) {
 		AutoCreateTimeColumns: autoCreateTimeColumns,
 		HasAutoUpdateTime:     hasAutoUpdateTime,
 		AutoUpdateTimeColumns: autoUpdateTimeColumns,
+		typ:                   rt,
+		fieldIndex:            fieldIndex,
+		autoIncrement:         autoIncrement,
+		autoCreateTime:        autoCreateTime,
+		autoUpdateTime:        autoUpdateTime,
+		tenant:                tenant,
+		sensitive:             sensitive,
+		references:            references,
+		columns:               columns,
 	}
+	// drop result types that may still point at a previous registration.
+	resultMetas.Range(func(k, _ interface{}) bool {
+		resultMetas.Delete(k)
+		return true
+	})
 }
 
+// VerboseLevel sets the level of the package logger used by builders
+// without WithLogger.
 func VerboseLevel(level int) {
 	switch level {
 	case 0:
-		logrus.SetLevel(logrus.PanicLevel)
+		std.SetLevel(logrus.PanicLevel)
 	case 1:
-		logrus.SetLevel(logrus.InfoLevel)
+		std.SetLevel(logrus.InfoLevel)
 	case 2:
-		logrus.SetLevel(logrus.DebugLevel)
+		std.SetLevel(logrus.DebugLevel)
 	case 3:
-		logrus.SetLevel(logrus.TraceLevel)
+		std.SetLevel(logrus.TraceLevel)
 	default:
 		panic("VerboseLevel is must be in range of 0 to 3")
 	}
@@ -1,6 +1,7 @@
 package torm
 
 import (
+	"strconv"
 	"testing"
 
 	"github.com/pinnacles/torm/internal/test"
@@ -71,3 +72,44 @@ func TestVerboseLevelInvalidPositive(t *testing.T) {
 
 	VerboseLevel(lv)
 }
+
+func TestRegisterPlans(t *testing.T) {
+	Register(test.TestSchema{})
+	m := metas["test"]
+
+	if !m.IsAutoIncrement("id") || m.IsAutoIncrement("foo") {
+		t.Error("IsAutoIncrement is not expected result")
+	}
+	if len(m.autoCreateTime) != 1 || m.autoCreateTime[0].column != "created_at" {
+		t.Errorf("unexpected autoCreateTime: %#v", m.autoCreateTime)
+	}
+	if len(m.autoUpdateTime) != 1 || m.autoUpdateTime[0].column != "updated_at" {
+		t.Errorf("unexpected autoUpdateTime: %#v", m.autoUpdateTime)
+	}
+
+	p1 := m.plan(insertPlan, MySQL, "", []string{"foo"})
+	p2 := m.plan(insertPlan, MySQL, "", []string{"foo"})
+	if p1 != p2 {
+		t.Error("plan is not cached")
+	}
+	if p3 := m.plan(insertPlan, Postgres, "", []string{"foo"}); p3 == p1 {
+		t.Error("plan is shared between dialects")
+	} else if p3.query != `INSERT INTO "test" ("foo","created_at","updated_at") VALUES (:foo,:created_at,:updated_at)` {
+		t.Errorf("unexpected query: %s", p3.query)
+	}
+}
+
+func TestPlanCacheBounded(t *testing.T) {
+	Register(test.TestSchema{})
+	m := metas["test"]
+
+	for i := 0; i < maxPlans+10; i++ {
+		m.plan(selectPlan, MySQL, "", []string{"foo", strconv.Itoa(i)})
+	}
+	if n := m.planCount.Load(); n != maxPlans {
+		t.Errorf("got %d cached plans, want %d", n, maxPlans)
+	}
+	if p := m.plan(selectPlan, MySQL, "", []string{"foo", "extra"}); p.query != "SELECT `foo`,`extra` FROM `test`" {
+		t.Errorf("unexpected query past the bound: %s", p.query)
+	}
+}
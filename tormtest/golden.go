@@ -0,0 +1,92 @@
+package tormtest
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pinnacles/torm"
+)
+
+var update = flag.Bool("tormtest.update", false, "rewrite the golden files of tormtest assertions")
+
+// AssertGolden compares got with testdata/<name>.golden, which it writes
+// instead when the test runs with -tormtest.update.
+func AssertGolden(tb testing.TB, name, got string) {
+	tb.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatalf("%v (run the test with -tormtest.update to create it)", err)
+	}
+	if got != string(want) {
+		tb.Errorf("%s differs from the golden file %s (run the test with -tormtest.update to rewrite it)\ngot:\n%s\nwant:\n%s", name, path, got, want)
+	}
+}
+
+// AssertSQL compares the statements generated by builder ToSQL calls with
+// a golden file.
+func AssertSQL(tb testing.TB, name string, sqls ...*torm.SQL) {
+	tb.Helper()
+	var b strings.Builder
+	for _, s := range sqls {
+		writeStatement(&b, s.Query, s.Args)
+	}
+	AssertGolden(tb, name, b.String())
+}
+
+// AssertGolden compares the statements recorded by h with a golden file.
+func (h *Handler) AssertGolden(tb testing.TB, name string) {
+	tb.Helper()
+	var b strings.Builder
+	for _, s := range h.Statements() {
+		writeStatement(&b, s.Query, s.Args)
+	}
+	AssertGolden(tb, name, b.String())
+}
+
+func writeStatement(b *strings.Builder, query string, args []interface{}) {
+	b.WriteString(query)
+	b.WriteString("\n")
+	if len(args) == 0 {
+		return
+	}
+	b.WriteString("-- args:")
+	for _, arg := range args {
+		b.WriteString(" ")
+		b.WriteString(formatArg(arg))
+	}
+	b.WriteString("\n")
+}
+
+func formatArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return strconv.Quote(v)
+	case []byte:
+		return fmt.Sprintf("0x%x", v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	if rv := reflect.ValueOf(arg); rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		return fmt.Sprintf("&%+v", rv.Elem().Interface())
+	}
+	return fmt.Sprintf("%+v", arg)
+}
@@ -0,0 +1,305 @@
+// Package tormtest helps testing code that uses torm: a fake handler that
+// records statements and returns programmed rows, golden file assertions
+// for generated SQL and a sqlmock helper.
+package tormtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm"
+)
+
+// Statement is a statement run on a Handler, with its arguments as given
+// to database/sql. Transactions record BEGIN, COMMIT and ROLLBACK.
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+// Handler is an in-memory database for torm builders. It runs nothing: it
+// records the statements it gets and answers them from the rules set with
+// OnQuery, OnExec and OnError. Queries without a rule return no rows and
+// execs without one affect no rows.
+type Handler struct {
+	*sqlx.DB
+
+	mu    sync.Mutex
+	stmts []Statement
+	rules []rule
+}
+
+type rule struct {
+	match        string
+	columns      []string
+	rows         [][]interface{}
+	rowsAffected int64
+	lastInsertID int64
+	err          error
+	query        bool
+	exec         bool
+}
+
+// NewHandler creates a Handler that generates SQL for the dialect d. It is
+// closed when the test ends.
+func NewHandler(tb testing.TB, d torm.Dialect) *Handler {
+	tb.Helper()
+	h := &Handler{}
+	dsn := strconv.FormatUint(handlers.add(h), 10)
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	h.DB = sqlx.NewDb(db, string(d))
+	tb.Cleanup(func() {
+		h.DB.Close()
+		handlers.remove(dsn)
+	})
+	return h
+}
+
+// OnQuery makes queries containing match return rows of columns.
+func (h *Handler) OnQuery(match string, columns []string, rows ...[]interface{}) {
+	h.addRule(rule{match: match, columns: columns, rows: rows, query: true})
+}
+
+// OnExec makes execs containing match report the given result.
+func (h *Handler) OnExec(match string, rowsAffected, lastInsertID int64) {
+	h.addRule(rule{match: match, rowsAffected: rowsAffected, lastInsertID: lastInsertID, exec: true})
+}
+
+// OnError makes queries and execs containing match fail with err.
+func (h *Handler) OnError(match string, err error) {
+	h.addRule(rule{match: match, err: err, query: true, exec: true})
+}
+
+func (h *Handler) addRule(r rule) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rules = append(h.rules, r)
+}
+
+// Statements returns the statements recorded so far.
+func (h *Handler) Statements() []Statement {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Statement(nil), h.stmts...)
+}
+
+// Reset forgets the recorded statements, but keeps the rules.
+func (h *Handler) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stmts = nil
+}
+
+// run records a statement and returns the first rule that matches it.
+func (h *Handler) run(query string, args []driver.NamedValue, isQuery bool) rule {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stmts = append(h.stmts, Statement{Query: query, Args: values})
+	for _, r := range h.rules {
+		if strings.Contains(query, r.match) && ((isQuery && r.query) || (!isQuery && r.exec)) {
+			return r
+		}
+	}
+	return rule{}
+}
+
+const driverName = "tormtest"
+
+func init() {
+	sql.Register(driverName, fakeDriver{})
+}
+
+// handlers maps the DSNs the fake driver opens to their Handler.
+var handlers = &registry{m: map[string]*Handler{}}
+
+type registry struct {
+	mu   sync.Mutex
+	next uint64
+	m    map[string]*Handler
+}
+
+func (r *registry) add(h *Handler) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.next++
+	r.m[strconv.FormatUint(r.next, 10)] = h
+	return r.next
+}
+
+func (r *registry) get(dsn string) *Handler {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.m[dsn]
+}
+
+func (r *registry) remove(dsn string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.m, dsn)
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	h := handlers.get(dsn)
+	if h == nil {
+		return nil, fmt.Errorf("tormtest: unknown handler %q", dsn)
+	}
+	return &conn{h: h}, nil
+}
+
+type conn struct {
+	h *Handler
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{c: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if r := c.h.run("BEGIN", nil, false); r.err != nil {
+		return nil, r.err
+	}
+	return tx{c}, nil
+}
+
+// CheckNamedValue keeps arguments as they were given, so that recorded
+// statements compare with the values the caller used.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, ok := nv.Value.(driver.Valuer); ok {
+		var err error
+		nv.Value, err = v.Value()
+		return err
+	}
+	return nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r := c.h.run(query, args, false)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return result{r.lastInsertID, r.rowsAffected}, nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r := c.h.run(query, args, true)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &rows{columns: r.columns, values: r.rows}, nil
+}
+
+type stmt struct {
+	c     *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.c.ExecContext(ctx, s.query, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.c.QueryContext(ctx, s.query, args)
+}
+
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	return s.c.CheckNamedValue(nv)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	nvs := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nvs[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nvs
+}
+
+type tx struct {
+	c *conn
+}
+
+func (t tx) Commit() error {
+	return t.c.h.run("COMMIT", nil, false).err
+}
+
+func (t tx) Rollback() error {
+	return t.c.h.run("ROLLBACK", nil, false).err
+}
+
+type result struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]interface{}
+	next    int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	for i, v := range r.values[r.next] {
+		dest[i] = v
+	}
+	r.next++
+	return nil
+}
@@ -0,0 +1,15 @@
+package tormtest
+
+import (
+	"context"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+// WithSqlxMock calls proc with a MySQL flavoured sqlx.DB backed by
+// sqlmock, for tests that want to set expectations statement by statement.
+func WithSqlxMock(proc func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock)) error {
+	return test.WithSqlxMock(proc)
+}
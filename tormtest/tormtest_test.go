@@ -0,0 +1,108 @@
+package tormtest_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm"
+	"github.com/pinnacles/torm/tormtest"
+)
+
+type user struct {
+	ID        int       `db:"id" torm:"autoIncrement"`
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at" torm:"autoCreateTime"`
+}
+
+func (u user) TableName() string {
+	return "users"
+}
+
+func init() {
+	torm.Register(user{})
+}
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	tm := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	h := tormtest.NewHandler(t, torm.Postgres)
+	h.OnExec("INSERT INTO", 1, 42)
+	h.OnQuery(`SELECT "id","name"`, []string{"id", "name"}, []interface{}{int64(1), "alice"}, []interface{}{int64(2), "bob"})
+	h.OnError("DELETE", errors.New("denied"))
+
+	builder := torm.NewBuilder(h.DB)
+	builder.SetTime(&tm)
+	if err := builder.Transaction(ctx, nil, func(ctx context.Context, b *torm.Builder) error {
+		res, err := b.Insert("name").Exec(ctx, &user{Name: "alice"})
+		if err != nil {
+			return err
+		}
+		if id, _ := res.LastInsertId(); id != 42 {
+			t.Errorf("got id %d, want 42", id)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	users := []user{}
+	if err := builder.Select("id", "name").Where("name <> :name", torm.KV{"name": "carol"}).Query(ctx, &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[1].Name != "bob" {
+		t.Errorf("unexpected users %+v", users)
+	}
+	if _, err := builder.Delete().Where("id = :id").Exec(ctx, &user{ID: 1}); err == nil || err.Error() != "denied" {
+		t.Errorf("got %v, want denied", err)
+	}
+
+	stmts := h.Statements()
+	if len(stmts) != 5 || stmts[0].Query != "BEGIN" || stmts[2].Query != "COMMIT" {
+		t.Fatalf("unexpected statements %+v", stmts)
+	}
+	if args := stmts[3].Args; len(args) != 1 || args[0] != "carol" {
+		t.Errorf("unexpected select args %v", args)
+	}
+	h.AssertGolden(t, "handler")
+
+	h.Reset()
+	if len(h.Statements()) != 0 {
+		t.Error("Reset kept statements")
+	}
+}
+
+func TestAssertSQL(t *testing.T) {
+	tm := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	builder := torm.NewBuilder(nil)
+	builder.SetTime(&tm)
+	insert, err := builder.Insert().ToSQL(&user{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	update, err := builder.Update("name").Where("id = :id").ToSQL(&user{ID: 1, Name: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tormtest.AssertSQL(t, "users", insert, update)
+}
+
+func TestWithSqlxMock(t *testing.T) {
+	if err := tormtest.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `users` WHERE id = ?")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		if _, err := torm.NewBuilder(db).Delete().Where("id = :id").Exec(ctx, &user{ID: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
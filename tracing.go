@@ -0,0 +1,172 @@
+package torm
+
+import (
+	"context"
+	"sync"
+)
+
+// Attribute is a key/value pair attached to a span or span event.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts spans. It mirrors the subset of the OpenTelemetry tracer
+// torm uses, so that an OpenTelemetry tracer is adapted in a few lines.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	AddEvent(name string, attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// WithTracer opens a span around every statement the builder runs and
+// around its transactions. Statement spans are opened where the option
+// appears among WithInterceptors options.
+func WithTracer(tr Tracer) Option {
+	return func(b *Builder) {
+		b.tracer = tr
+		system := dialectOf(b.h).system()
+		WithInterceptors(func(ctx context.Context, op Op, sql *SQL, next Invoker) (Result, error) {
+			ctx, span := tr.Start(ctx, op.Kind.String()+" "+op.Target,
+				Attribute{"db.system", system},
+				Attribute{"db.statement", sql.Query},
+				Attribute{"db.sql.table", op.Target},
+				Attribute{"db.operation", op.Kind.String()},
+			)
+			defer span.End()
+			res, err := next(ctx, op, sql)
+			if res.Rows >= 0 {
+				span.SetAttributes(Attribute{"db.rows_affected", res.Rows})
+			}
+			if err != nil {
+				span.RecordError(err)
+			}
+			return res, err
+		})(b)
+	}
+}
+
+// WithTxTracer opens a span around the transaction, with an event for the
+// commit or rollback of every attempt. Builder.Transaction uses the tracer
+// of the builder by default.
+func WithTxTracer(tr Tracer) TxOption {
+	return func(cfg *txConfig) {
+		cfg.tracer = tr
+	}
+}
+
+func (d Dialect) system() string {
+	switch d {
+	case Postgres:
+		return "postgresql"
+	case SQLite:
+		return "sqlite"
+	case SQLServer:
+		return "mssql"
+	default:
+		return "mysql"
+	}
+}
+
+// trace runs fn inside a span named name when the config has a tracer.
+func (cfg *txConfig) trace(ctx context.Context, name string, fn func(context.Context) error) error {
+	if cfg.tracer == nil {
+		return fn(ctx)
+	}
+	ctx, cfg.span = cfg.tracer.Start(ctx, name)
+	defer cfg.span.End()
+	err := fn(ctx)
+	if err != nil {
+		cfg.span.RecordError(err)
+	}
+	return err
+}
+
+func (cfg *txConfig) event(name string, attrs ...Attribute) {
+	if cfg.span != nil {
+		cfg.span.AddEvent(name, attrs...)
+	}
+}
+
+type spanKey struct{}
+
+// SpanRecorder is a Tracer that keeps its spans in memory, for tests.
+type SpanRecorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+type RecordedSpan struct {
+	Name       string
+	Parent     *RecordedSpan
+	Attributes map[string]interface{}
+	Events     []SpanEvent
+	Errors     []error
+	Ended      bool
+
+	r *SpanRecorder
+}
+
+type SpanEvent struct {
+	Name       string
+	Attributes map[string]interface{}
+}
+
+func NewSpanRecorder() *SpanRecorder {
+	return &SpanRecorder{}
+}
+
+func (r *SpanRecorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*RecordedSpan)
+	s := &RecordedSpan{Name: name, Parent: parent, Attributes: attributeMap(attrs), r: r}
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Spans returns the spans started so far, in start order.
+func (r *SpanRecorder) Spans() []*RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*RecordedSpan(nil), r.spans...)
+}
+
+func (s *RecordedSpan) SetAttributes(attrs ...Attribute) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	for _, a := range attrs {
+		s.Attributes[a.Key] = a.Value
+	}
+}
+
+func (s *RecordedSpan) AddEvent(name string, attrs ...Attribute) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.Events = append(s.Events, SpanEvent{Name: name, Attributes: attributeMap(attrs)})
+}
+
+func (s *RecordedSpan) RecordError(err error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.Errors = append(s.Errors, err)
+}
+
+func (s *RecordedSpan) End() {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.Ended = true
+}
+
+func attributeMap(attrs []Attribute) map[string]interface{} {
+	m := make(map[string]interface{}, len(attrs))
+	for _, a := range attrs {
+		m[a.Key] = a.Value
+	}
+	return m
+}
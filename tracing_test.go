@@ -0,0 +1,116 @@
+package torm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/pinnacles/torm/internal/test"
+)
+
+func TestTracerTransaction(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		tm := time.Now()
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `test`").WithArgs(1, tm, tm).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("SAVEPOINT torm_sp_").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM `test`").WithArgs(1).WillReturnError(errors.New("delete error"))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT torm_sp_").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		r := NewSpanRecorder()
+		builder := NewBuilder(db, WithTracer(r))
+		builder.SetTime(&tm)
+		if err := builder.Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+			if _, err := b.Insert().Exec(ctx, &test.TestSchema{Foo: 1}); err != nil {
+				return err
+			}
+			if err := b.Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+				_, err := b.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1})
+				return err
+			}); err == nil {
+				t.Error("expected the savepoint to fail")
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		spans := r.Spans()
+		if len(spans) != 4 {
+			t.Fatalf("got %d spans, want 4", len(spans))
+		}
+		tx, insert, sp, del := spans[0], spans[1], spans[2], spans[3]
+		if tx.Name != "torm.transaction" || tx.Parent != nil || len(tx.Events) != 1 || tx.Events[0].Name != "commit" {
+			t.Errorf("unexpected transaction span %+v", tx)
+		}
+		if insert.Name != "INSERT test" || insert.Parent != tx {
+			t.Errorf("unexpected insert span %+v", insert)
+		}
+		want := map[string]interface{}{
+			"db.system":        "mysql",
+			"db.statement":     "INSERT INTO `test` (`foo`,`created_at`,`updated_at`) VALUES (:foo,:created_at,:updated_at)",
+			"db.sql.table":     "test",
+			"db.operation":     "INSERT",
+			"db.rows_affected": int64(1),
+		}
+		for k, v := range want {
+			if insert.Attributes[k] != v {
+				t.Errorf("insert span %s = %v, want %v", k, insert.Attributes[k], v)
+			}
+		}
+		if sp.Name != "torm.savepoint" || sp.Parent != tx || len(sp.Events) != 1 || sp.Events[0].Name != "rollback" || len(sp.Errors) != 1 {
+			t.Errorf("unexpected savepoint span %+v", sp)
+		}
+		if del.Name != "DELETE test" || del.Parent != sp || len(del.Errors) != 1 {
+			t.Errorf("unexpected delete span %+v", del)
+		}
+		for _, s := range spans {
+			if !s.Ended {
+				t.Errorf("span %s was not ended", s.Name)
+			}
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxTracerRetry(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		r := NewSpanRecorder()
+		attempts := 0
+		if err := Transaction(ctx, nil, db, func(tx *sqlx.Tx) error {
+			if attempts++; attempts == 1 {
+				return errors.New("Error 1213: Deadlock found")
+			}
+			return nil
+		}, WithRetry(RetryPolicy{MaxAttempts: 2}), WithTxTracer(r)); err != nil {
+			t.Fatal(err)
+		}
+
+		spans := r.Spans()
+		if len(spans) != 1 {
+			t.Fatalf("got %d spans, want 1", len(spans))
+		}
+		events := spans[0].Events
+		if len(events) != 2 || events[0].Name != "rollback" || events[1].Name != "commit" || events[1].Attributes["torm.tx.attempt"] != 2 {
+			t.Errorf("unexpected events %+v", events)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,29 +5,199 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 
 	"github.com/jmoiron/sqlx"
 )
 
+var ErrNoBeginner = errors.New("torm: handler can't begin a transaction")
+
+// PanicError is returned by a transaction whose body or commit panicked,
+// when WithPanicAsError is given. The transaction has been rolled back.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("torm: panic in transaction: %v", e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// WithPanicAsError makes Transaction return a *PanicError instead of
+// re-panicking after it has rolled back a transaction, or savepoint, that
+// panicked.
+func WithPanicAsError() TxOption {
+	return func(cfg *txConfig) {
+		cfg.panicAsError = true
+	}
+}
+
 type Proc func(*sqlx.Tx) error
 
-func Transaction(ctx context.Context, opts *sql.TxOptions, sql *sqlx.DB, proc Proc) (err error) {
+// ProcContext is a Proc that also receives a context carrying the
+// transaction, which nested transactions find it through.
+type ProcContext func(ctx context.Context, tx *sqlx.Tx) error
+
+type beginner interface {
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+}
+
+type txKey struct{}
+
+// txScope is a transaction, or a savepoint of one when parent is set. db is
+// the handler the transaction was begun on; only builders over the same
+// handler join it.
+type txScope struct {
+	tx     *sqlx.Tx
+	db     handler
+	parent *txScope
+	// detached is set for transactions that torm did not begin, whose
+	// outcome it never learns.
+	detached bool
+
+	mu         sync.Mutex
+	onCommit   []func()
+	onRollback []func()
+}
+
+// txScopes maps the transactions torm is running to their innermost scope,
+// so that builders created with NewBuilder(tx) find it as well.
+var txScopes sync.Map
+
+func scopeOfTx(tx *sqlx.Tx) *txScope {
+	if scope, ok := txScopes.Load(tx); ok {
+		return scope.(*txScope)
+	}
+	return nil
+}
+
+func txFromContext(ctx context.Context) *txScope {
+	scope, _ := ctx.Value(txKey{}).(*txScope)
+	return scope
+}
+
+// TxFromContext returns the transaction started by Builder.Transaction that
+// ctx carries, if any.
+func TxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	if scope := txFromContext(ctx); scope != nil {
+		return scope.tx, true
+	}
+	return nil, false
+}
+
+// Transaction runs proc in a transaction begun on sql. When ctx already
+// carries a transaction of sql, proc runs inside a savepoint of it instead.
+// proc gets no context, so transactions it starts cannot find this one; use
+// TransactionContext to nest them.
+func Transaction(ctx context.Context, opts *sql.TxOptions, sql *sqlx.DB, proc Proc, options ...TxOption) error {
+	return TransactionContext(ctx, opts, sql, func(_ context.Context, tx *sqlx.Tx) error {
+		return proc(tx)
+	}, options...)
+}
+
+// TransactionContext is Transaction for a proc that receives a context
+// carrying the transaction. Transaction and TransactionContext calls on sql
+// made with that context run inside a savepoint of it.
+func TransactionContext(ctx context.Context, opts *sql.TxOptions, sql *sqlx.DB, proc ProcContext, options ...TxOption) error {
+	run := func(ctx context.Context, scope *txScope) error {
+		return proc(context.WithValue(ctx, txKey{}, scope), scope.tx)
+	}
+	cfg := newTxConfig(options)
+	if scope := txFromContext(ctx); scope != nil && scope.db == handler(sql) {
+		return cfg.savepoint(ctx, scope, run)
+	}
+	return transaction(ctx, opts, sql, sql, run, cfg)
+}
+
+// transaction runs fn in a new transaction, once more for every retryable
+// failure the retry policy allows. The errors of all attempts are joined.
+func transaction(ctx context.Context, opts *sql.TxOptions, db beginner, origin handler, fn func(context.Context, *txScope) error, cfg *txConfig) error {
+	return cfg.trace(ctx, "torm.transaction", func(ctx context.Context) error {
+		return retryTx(ctx, opts, db, origin, fn, cfg)
+	})
+}
+
+func retryTx(ctx context.Context, opts *sql.TxOptions, db beginner, origin handler, fn func(context.Context, *txScope) error, cfg *txConfig) error {
+	var errs []error
+	var waitErr error
+	// last is the scope of the last attempt, whose callbacks run once it is
+	// known that no attempt follows. Retried attempts drop theirs; the
+	// next attempt registers them again.
+	var last *txScope
+	for attempt := 1; ; attempt++ {
+		scope, err := runTx(ctx, opts, db, origin, fn, cfg)
+		if err == nil {
+			cfg.event("commit", Attribute{"torm.tx.attempt", attempt})
+			scope.finish(true)
+			return nil
+		}
+		cfg.event("rollback", Attribute{"torm.tx.attempt", attempt}, Attribute{"error", err.Error()})
+		errs = append(errs, err)
+		last = scope
+
+		p := cfg.retry
+		if p == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+			break
+		}
+		if waitErr = p.wait(ctx, attempt); waitErr != nil {
+			break
+		}
+	}
+	if last != nil {
+		last.finish(false)
+	}
+
+	if len(errs) == 1 && waitErr == nil {
+		return errs[0]
+	}
+	for i, err := range errs {
+		errs[i] = fmt.Errorf("attempt %d: %w", i+1, err)
+	}
+	return errors.Join(append(errs, waitErr)...)
+}
+
+// runTx runs fn in a transaction and returns its scope, whose callbacks
+// are left for the caller to run. A panic that is re-raised runs the
+// rollback callbacks first, as no attempt follows it.
+func runTx(ctx context.Context, opts *sql.TxOptions, db beginner, origin handler, fn func(context.Context, *txScope) error, cfg *txConfig) (scope *txScope, err error) {
 	var tx *sqlx.Tx
 
 	defer func() {
+		r := recover()
+		if r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
 		if err != nil && tx != nil {
 			if e := tx.Rollback(); e != nil {
 				err = errors.Join(err, fmt.Errorf("failed to rollback transaction: %v", e))
 			}
 		}
+		if scope != nil {
+			txScopes.Delete(tx)
+		}
+		if r != nil && !cfg.panicAsError {
+			if scope != nil {
+				scope.finish(false)
+			}
+			panic(r)
+		}
 	}()
 
-	tx, err = sql.BeginTxx(ctx, opts)
+	tx, err = db.BeginTxx(ctx, opts)
 	if err != nil {
 		return
 	}
+	scope = &txScope{tx: tx, db: origin}
+	txScopes.Store(tx, scope)
 
-	if err = proc(tx); err != nil {
+	if err = fn(ctx, scope); err != nil {
 		return
 	}
 
@@ -35,5 +205,131 @@ func Transaction(ctx context.Context, opts *sql.TxOptions, sql *sqlx.DB, proc Pr
 		return
 	}
 
+	return scope, nil
+}
+
+var savepointSeq uint64
+
+// savepoint runs fn inside a new savepoint of parent. The savepoint is
+// rolled back when fn fails or panics and released when it succeeds. A
+// panic is re-raised after the rollback unless panicAsError is set.
+func savepoint(ctx context.Context, parent *txScope, fn func(context.Context, *txScope) error, panicAsError bool) (err error) {
+	tx := parent.tx
+	d := dialectOf(tx)
+	name := fmt.Sprintf("torm_sp_%d", atomic.AddUint64(&savepointSeq, 1))
+
+	if _, err = tx.ExecContext(ctx, d.savepoint(name)); err != nil {
+		return
+	}
+
+	scope := &txScope{tx: tx, db: parent.db, parent: parent, detached: parent.detached}
+	if !scope.detached {
+		txScopes.Store(tx, scope)
+	}
+	defer func() {
+		r := recover()
+		if r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+		if !scope.detached {
+			txScopes.Store(tx, parent)
+		}
+		if err != nil {
+			if _, e := tx.ExecContext(ctx, d.rollbackTo(name)); e != nil {
+				err = errors.Join(err, fmt.Errorf("failed to rollback to savepoint: %v", e))
+			}
+			scope.finish(false)
+		} else {
+			scope.release()
+		}
+		if r != nil && !panicAsError {
+			panic(r)
+		}
+	}()
+
+	if err = fn(ctx, scope); err != nil {
+		return
+	}
+
+	if q := d.releaseSavepoint(name); q != "" {
+		if _, err = tx.ExecContext(ctx, q); err != nil {
+			return
+		}
+	}
+
 	return nil
 }
+
+// savepoint runs fn inside a savepoint of parent, traced when the config
+// has a tracer.
+func (cfg *txConfig) savepoint(ctx context.Context, parent *txScope, fn func(context.Context, *txScope) error) error {
+	return cfg.trace(ctx, "torm.savepoint", func(ctx context.Context) error {
+		err := savepoint(ctx, parent, fn, cfg.panicAsError)
+		if err != nil {
+			cfg.event("rollback", Attribute{"error", err.Error()})
+		} else {
+			cfg.event("release")
+		}
+		return err
+	})
+}
+
+// Transaction runs fn in a transaction begun on the builder's handler. fn
+// receives a builder bound to the transaction and a context that carries
+// it, so builders over the same handler that are called with that context
+// join the transaction as well. When the builder already runs on a
+// transaction, or ctx carries one for it, fn runs inside a savepoint.
+func (t *Builder) Transaction(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context, b *Builder) error, options ...TxOption) error {
+	run := func(ctx context.Context, scope *txScope) error {
+		return fn(context.WithValue(ctx, txKey{}, scope), t.withHandler(scope.tx))
+	}
+	cfg := &txConfig{tracer: t.tracer}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	if tx, ok := t.h.(*sqlx.Tx); ok {
+		parent := scopeOfTx(tx)
+		if parent == nil {
+			parent = &txScope{tx: tx, db: tx, detached: true}
+		}
+		return cfg.savepoint(ctx, parent, run)
+	}
+	if scope := t.scope(ctx); scope != nil {
+		return cfg.savepoint(ctx, scope, run)
+	}
+
+	db, ok := t.h.(beginner)
+	if !ok {
+		return ErrNoBeginner
+	}
+	return transaction(ctx, opts, db, t.h, run, cfg)
+}
+
+// scope returns the transaction carried by ctx when it was begun on the
+// builder's handler.
+func (t *Builder) scope(ctx context.Context) *txScope {
+	scope := txFromContext(ctx)
+	if scope == nil || scope.db != t.h {
+		return nil
+	}
+	return scope
+}
+
+// target returns the handler a statement runs on: the ambient transaction
+// when ctx carries one for this builder, the database a router picks for
+// it, or the builder's handler.
+func (t *Builder) target(ctx context.Context, write bool) handler {
+	if scope := t.scope(ctx); scope != nil {
+		return scope.tx
+	}
+	if r, ok := t.h.(router); ok {
+		return r.route(ctx, write)
+	}
+	return t.h
+}
+
+func (t *Builder) withHandler(h handler) *Builder {
+	b := *t
+	b.h = h
+	return &b
+}
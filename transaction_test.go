@@ -2,6 +2,8 @@ package torm
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"testing"
 	"time"
@@ -56,3 +58,353 @@ func TestTransactionRollback(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestBuilderTransactionCommit(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		tm := time.Now()
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `test`").WithArgs(1, tm, tm).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		builder := NewBuilder(db)
+		builder.SetTime(&tm)
+		if err := builder.Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+			if _, ok := b.h.(*sqlx.Tx); !ok {
+				t.Error("builder is not bound to the transaction")
+			}
+			_, err := b.Insert().Exec(ctx, &test.TestSchema{Foo: 1, Bar: 2})
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuilderTransactionAmbient(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT \\* FROM `test`").WillReturnRows(sqlmock.NewRows([]string{"foo"}).AddRow(1))
+		mock.ExpectExec("DELETE FROM `test`").WithArgs(1).WillReturnError(errors.New("delete error"))
+		mock.ExpectRollback()
+
+		// repo stands for repository code that only knows the shared builder.
+		repo := NewBuilder(db)
+		if err := repo.Transaction(ctx, nil, func(ctx context.Context, _ *Builder) error {
+			if _, ok := TxFromContext(ctx); !ok {
+				t.Error("context doesn't carry the transaction")
+			}
+			ts := test.TestSchema{}
+			if err := repo.Select("*").Query(ctx, &ts); err != nil {
+				return err
+			}
+			_, err := repo.Delete().Where("foo = :foo").Exec(ctx, &ts)
+			return err
+		}); err == nil {
+			t.Fatal("error was expected")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuilderTransactionOtherHandler(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		other := NewBuilder(sqlx.NewDb(db.DB, "mysql"))
+		if err := NewBuilder(db).Transaction(ctx, nil, func(ctx context.Context, _ *Builder) error {
+			if other.target(ctx, true) != other.h {
+				t.Error("builder over another handler joined the transaction")
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionSavepointRelease(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT torm_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM `test`").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("RELEASE SAVEPOINT torm_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		builder := NewBuilder(db)
+		if err := builder.Transaction(ctx, nil, func(ctx context.Context, _ *Builder) error {
+			return builder.Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+				_, err := b.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1})
+				return err
+			})
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionSavepointRollback(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT torm_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM `test`").WithArgs(1).WillReturnError(errors.New("delete error"))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT torm_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM `test`").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := Transaction(ctx, nil, db, func(tx *sqlx.Tx) error {
+			builder := NewBuilder(tx)
+			if err := builder.Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+				_, err := b.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1})
+				return err
+			}); err == nil {
+				t.Error("error was expected")
+			}
+			_, err := builder.Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 2})
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionNestedInContext(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT torm_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("RELEASE SAVEPOINT torm_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		if err := NewBuilder(db).Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+			return Transaction(ctx, nil, db, func(tx *sqlx.Tx) error {
+				if b.h != tx {
+					t.Error("nested transaction doesn't run on the outer transaction")
+				}
+				return nil
+			})
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionPanicRollback(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		func() {
+			defer func() {
+				if r := recover(); r != "proc panic" {
+					t.Errorf("unexpected recover: %v", r)
+				}
+			}()
+			_ = Transaction(ctx, nil, db, func(tx *sqlx.Tx) error {
+				panic("proc panic")
+			})
+			t.Error("Transaction didn't re-panic")
+		}()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionPanicAsError(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		cause := errors.New("proc panic")
+		err := NewBuilder(db).Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+			panic(cause)
+		}, WithPanicAsError())
+		var perr *PanicError
+		if !errors.As(err, &perr) {
+			t.Fatalf("PanicError was expected: %v", err)
+		}
+		if !errors.Is(err, cause) || len(perr.Stack) == 0 {
+			t.Errorf("unexpected PanicError: %#v", perr)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// panicDriver is a driver whose transactions panic on commit.
+type panicDriver struct{}
+
+func (panicDriver) Open(string) (driver.Conn, error) { return panicConn{}, nil }
+
+type panicConn struct{}
+
+func (panicConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (panicConn) Close() error                        { return nil }
+func (panicConn) Begin() (driver.Tx, error)           { return panicTx{}, nil }
+
+type panicTx struct{}
+
+func (panicTx) Commit() error   { panic("commit panic") }
+func (panicTx) Rollback() error { return nil }
+
+func init() {
+	sql.Register("torm-panic", panicDriver{})
+}
+
+func TestTransactionPanicInCommit(t *testing.T) {
+	db, err := sqlx.Open("torm-panic", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = Transaction(context.Background(), nil, db, func(tx *sqlx.Tx) error {
+		return nil
+	}, WithPanicAsError())
+	var perr *PanicError
+	if !errors.As(err, &perr) || perr.Value != "commit panic" {
+		t.Fatalf("PanicError was expected: %v", err)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "commit panic" {
+				t.Errorf("unexpected recover: %v", r)
+			}
+		}()
+		_ = Transaction(context.Background(), nil, db, func(tx *sqlx.Tx) error {
+			return nil
+		})
+		t.Error("Transaction didn't re-panic")
+	}()
+}
+
+func TestTransactionContextNested(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT torm_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM `test`").WithArgs(1).WillReturnError(errors.New("delete error"))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT torm_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		if err := TransactionContext(ctx, nil, db, func(ctx context.Context, outer *sqlx.Tx) error {
+			err := TransactionContext(ctx, nil, db, func(ctx context.Context, tx *sqlx.Tx) error {
+				if tx != outer {
+					t.Error("nested transaction doesn't run on the outer transaction")
+				}
+				_, err := NewBuilder(tx).Delete().Where("foo = :foo").Exec(ctx, &test.TestSchema{Foo: 1})
+				return err
+			})
+			if err == nil {
+				t.Error("error was expected")
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionSavepointPanic(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT torm_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT torm_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		var calls []string
+		builder := NewBuilder(db)
+		func() {
+			defer func() {
+				if r := recover(); r != "savepoint panic" {
+					t.Errorf("unexpected recover: %v", r)
+				}
+			}()
+			_ = builder.Transaction(ctx, nil, func(ctx context.Context, _ *Builder) error {
+				return builder.Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+					_ = b.OnCommit(func() { calls = append(calls, "commit") })
+					_ = b.OnRollback(func() { calls = append(calls, "rollback") })
+					panic("savepoint panic")
+				})
+			})
+			t.Error("Transaction didn't re-panic")
+		}()
+		if len(calls) != 1 || calls[0] != "rollback" {
+			t.Errorf("unexpected callbacks %v", calls)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionSavepointPanicAsError(t *testing.T) {
+	if err := test.WithSqlxMock(func(ctx context.Context, db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT torm_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT torm_sp_[0-9]+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		// the parent is a transaction torm did not begin.
+		tx, err := db.Beginx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = NewBuilder(tx).Transaction(ctx, nil, func(ctx context.Context, b *Builder) error {
+			panic("savepoint panic")
+		}, WithPanicAsError())
+		var perr *PanicError
+		if !errors.As(err, &perr) || perr.Value != "savepoint panic" {
+			t.Fatalf("PanicError was expected: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}